@@ -26,6 +26,10 @@ func NewFromEnv() (pactproxy.Config, error) {
 }
 
 func ConfigureProxy(config pactproxy.Config) error {
+	if err := config.Validate(); err != nil {
+		return errors.Wrap(err, "invalid configuration")
+	}
+
 	targetURL := config.Target
 
 	// If ServerAddress is not passed, listen on the target port
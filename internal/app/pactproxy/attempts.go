@@ -0,0 +1,89 @@
+package pactproxy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// attemptRange matches the request counts between from and to inclusive, every step requests.
+// A to of zero leaves the range open.
+type attemptRange struct {
+	from, to, step int
+}
+
+type attempts []attemptRange
+
+// parseAttempts parses a comma separated list of attempt patterns:
+//
+//	3        the third request
+//	1-3      the first to the third request
+//	4+       the fourth request onwards
+//	every 3  every third request
+//	first 2  the first two requests
+func parseAttempts(value string) (attempts, error) {
+	var result attempts
+	for _, term := range strings.Split(value, ",") {
+		term = strings.TrimSpace(term)
+		r, err := parseAttemptRange(term)
+		if err != nil {
+			return nil, fmt.Errorf("invalid attempts %q: %w", value, err)
+		}
+		result = append(result, r)
+	}
+	return result, nil
+}
+
+func parseAttemptRange(term string) (attemptRange, error) {
+	switch {
+	case strings.HasPrefix(term, "every "):
+		n, err := parseAttemptCount(strings.TrimPrefix(term, "every "))
+		return attemptRange{from: n, step: n}, err
+	case strings.HasPrefix(term, "first "):
+		n, err := parseAttemptCount(strings.TrimPrefix(term, "first "))
+		return attemptRange{from: 1, to: n, step: 1}, err
+	case strings.HasSuffix(term, "+"):
+		n, err := parseAttemptCount(strings.TrimSuffix(term, "+"))
+		return attemptRange{from: n, step: 1}, err
+	case strings.Contains(term, "-"):
+		bounds := strings.SplitN(term, "-", 2)
+		from, err := parseAttemptCount(bounds[0])
+		if err != nil {
+			return attemptRange{}, err
+		}
+		to, err := parseAttemptCount(bounds[1])
+		if err != nil {
+			return attemptRange{}, err
+		}
+		if to < from {
+			return attemptRange{}, fmt.Errorf("range %q ends before it starts", term)
+		}
+		return attemptRange{from: from, to: to, step: 1}, nil
+	default:
+		n, err := parseAttemptCount(term)
+		return attemptRange{from: n, to: n, step: 1}, err
+	}
+}
+
+func parseAttemptCount(value string) (int, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("%q is not an attempt number", value)
+	}
+	if n < 1 {
+		return 0, fmt.Errorf("attempt numbers start at 1, got %d", n)
+	}
+	return n, nil
+}
+
+func (a attempts) matches(requestCount int) bool {
+	for _, r := range a {
+		if requestCount < r.from || (r.to != 0 && requestCount > r.to) {
+			continue
+		}
+		if (requestCount-r.from)%r.step == 0 {
+			return true
+		}
+	}
+	return false
+}
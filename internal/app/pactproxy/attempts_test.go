@@ -0,0 +1,65 @@
+package pactproxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAttempts(t *testing.T) {
+	tests := []struct {
+		name     string
+		attempts string
+		matches  []int
+		misses   []int
+	}{
+		{name: "single", attempts: "3", matches: []int{3}, misses: []int{1, 2, 4}},
+		{name: "range", attempts: "1-3", matches: []int{1, 2, 3}, misses: []int{4, 10}},
+		{name: "open range", attempts: "4+", matches: []int{4, 5, 100}, misses: []int{1, 3}},
+		{name: "list", attempts: "1, 3, 5-6", matches: []int{1, 3, 5, 6}, misses: []int{2, 4, 7}},
+		{name: "every nth", attempts: "every 3", matches: []int{3, 6, 9}, misses: []int{1, 2, 4, 5}},
+		{name: "first n", attempts: "first 2", matches: []int{1, 2}, misses: []int{3, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts, err := parseAttempts(tt.attempts)
+			require.NoError(t, err)
+			for _, n := range tt.matches {
+				assert.Truef(t, attempts.matches(n), "expected %q to match attempt %d", tt.attempts, n)
+			}
+			for _, n := range tt.misses {
+				assert.Falsef(t, attempts.matches(n), "expected %q not to match attempt %d", tt.attempts, n)
+			}
+		})
+	}
+}
+
+func TestParseAttemptsErrors(t *testing.T) {
+	for _, attempts := range []string{"", "0", "-1", "3-1", "a+", "every 0", "first x", "1,,2"} {
+		_, err := parseAttempts(attempts)
+		assert.Errorf(t, err, "expected %q to be rejected", attempts)
+	}
+}
+
+func TestModifierAttemptsPrecedence(t *testing.T) {
+	i := newInteraction("get-user")
+	attempt := 2
+	i.modifiers.AddModifier(&interactionModifier{Interaction: "get-user", Path: "$.status", Value: 500})
+	i.modifiers.AddModifier(&interactionModifier{Interaction: "get-user", Path: "$.status", Value: 503, Attempts: "1-3"})
+	i.modifiers.AddModifier(&interactionModifier{Interaction: "get-user", Path: "$.status", Value: 429, Attempt: &attempt})
+
+	for n, expected := range map[int]int{1: 503, 2: 429, 3: 503, 4: 500} {
+		ok, code := i.modifiers.modifyStatusCode(n, nil)
+		assert.True(t, ok)
+		assert.Equalf(t, expected, code, "attempt %d", n)
+	}
+}
+
+func TestModifierAttemptsValidation(t *testing.T) {
+	attempt := 1
+	assert.Error(t, (&interactionModifier{Path: "$.status", Value: 503, Attempts: "1-", Attempt: nil}).validate())
+	assert.Error(t, (&interactionModifier{Path: "$.status", Value: 503, Attempts: "1-2", Attempt: &attempt}).validate())
+	assert.NoError(t, (&interactionModifier{Path: "$.status", Value: 503, Attempts: "first 2"}).validate())
+}
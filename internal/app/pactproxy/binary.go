@@ -0,0 +1,23 @@
+package pactproxy
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/url"
+)
+
+// ParseBinaryRequest handles bodies of any media type that is not parsed otherwise, such as
+// application/octet-stream, application/pdf or images. The body is exposed by its size in "$.body_size",
+// its hex encoded SHA-256 digest in "$.body_sha256" and its base64 encoded content in "$.bytes.body".
+func ParseBinaryRequest(data []byte, url *url.URL, _ map[string]string) (requestDocument, error) {
+	digest := sha256.Sum256(data)
+
+	request := newRequestDocument(url, nil)
+	request["body_size"] = len(data)
+	request["body_sha256"] = hex.EncodeToString(digest[:])
+	request["bytes"] = map[string]interface{}{
+		"body": base64.StdEncoding.EncodeToString(data),
+	}
+	return request, nil
+}
@@ -1,22 +1,109 @@
 package pactproxy
 
 import (
+	"encoding/json"
 	"fmt"
+	"regexp"
+	"strconv"
 	"strings"
 )
 
 const fmtLen = "_length_"
 
+const (
+	operatorRegex      = "regex"
+	operatorNotEquals  = "not_equals"
+	operatorOneOf      = "one_of"
+	operatorContains   = "contains"
+	operatorStartsWith = "starts_with"
+	operatorGt         = "gt"
+	operatorGte        = "gte"
+	operatorLt         = "lt"
+	operatorLte        = "lte"
+	operatorBetween    = "between"
+)
+
 type interactionConstraint struct {
 	Interaction string        `json:"interaction"`
 	Path        string        `json:"path"`
 	Values      []interface{} `json:"values"`
 	Format      string        `json:"format"`
 	Source      string        `json:"source"`
+	Operator    string        `json:"operator,omitempty"`
+	Rule        *matchingRule `json:"rule,omitempty"`
+	Scenario    string        `json:"scenario,omitempty"`
+	State       string        `json:"state,omitempty"`
 }
 
 func (i interactionConstraint) Key() string {
-	return strings.Join([]string{i.Interaction, i.Path}, "_")
+	var key string
+	switch {
+	case i.Rule != nil:
+		key = strings.Join([]string{i.Interaction, i.Path, "rule"}, "_")
+	case i.Operator != "":
+		key = strings.Join([]string{i.Interaction, i.Path, i.Operator}, "_")
+	default:
+		key = strings.Join([]string{i.Interaction, i.Path}, "_")
+	}
+	if i.Scenario != "" {
+		key = strings.Join([]string{key, i.Scenario, i.State}, "_")
+	}
+	return key
+}
+
+// validate checks that the operator is known and has the number of values it needs.
+// Values of constraints with a source are json paths, so they are only checked once resolved.
+func (i interactionConstraint) validate() error {
+	if (i.Scenario == "") != (i.State == "") {
+		return fmt.Errorf("scenario and state must be used together")
+	}
+	if i.Source != "" {
+		for _, v := range i.Values {
+			if _, ok := v.(string); !ok {
+				return fmt.Errorf("values of a constraint with a source must be json paths, got %v", v)
+			}
+		}
+	}
+	if i.Rule != nil {
+		return i.Rule.validate()
+	}
+	switch i.Operator {
+	case "":
+		return nil
+	case operatorRegex, operatorNotEquals, operatorContains, operatorStartsWith,
+		operatorGt, operatorGte, operatorLt, operatorLte:
+		if len(i.Values) != 1 {
+			return fmt.Errorf("operator %q expects a single value, got %d", i.Operator, len(i.Values))
+		}
+	case operatorOneOf:
+		if len(i.Values) == 0 {
+			return fmt.Errorf("operator %q expects at least one value", i.Operator)
+		}
+	case operatorBetween:
+		if len(i.Values) != 2 {
+			return fmt.Errorf("operator %q expects a minimum and a maximum value, got %d values", i.Operator, len(i.Values))
+		}
+	default:
+		return fmt.Errorf("unknown constraint operator %q", i.Operator)
+	}
+
+	if i.Source != "" {
+		return nil
+	}
+
+	switch i.Operator {
+	case operatorRegex:
+		if _, err := regexp.Compile(fmt.Sprintf("%v", i.Values[0])); err != nil {
+			return fmt.Errorf("invalid regex for path %q: %w", i.Path, err)
+		}
+	case operatorGt, operatorGte, operatorLt, operatorLte, operatorBetween:
+		for _, v := range i.Values {
+			if _, err := toFloat(v); err != nil {
+				return fmt.Errorf("operator %q expects numeric values: %w", i.Operator, err)
+			}
+		}
+	}
+	return nil
 }
 
 func (i interactionConstraint) check(expectedValues []interface{}, actualValue interface{}) error {
@@ -42,6 +129,14 @@ func (i interactionConstraint) check(expectedValues []interface{}, actualValue i
 		return nil
 	}
 
+	if i.Rule != nil {
+		return i.checkRule(expectedValues, actualValue)
+	}
+
+	if i.Operator != "" {
+		return i.checkOperator(expectedValues, actualValue)
+	}
+
 	expected := fmt.Sprintf(i.Format, expectedValues...)
 	actual := fmt.Sprintf("%v", actualValue)
 	if expected != actual {
@@ -49,3 +144,170 @@ func (i interactionConstraint) check(expectedValues []interface{}, actualValue i
 	}
 	return nil
 }
+
+func (i interactionConstraint) checkOperator(expectedValues []interface{}, actualValue interface{}) error {
+	actual := fmt.Sprintf("%v", actualValue)
+
+	switch i.Operator {
+	case operatorRegex:
+		pattern := i.format(expectedValues[0])
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid regex %q for path %q: %w", pattern, i.Path, err)
+		}
+		if !re.MatchString(actual) {
+			return fmt.Errorf("value %q at path %q does not match regex %q", actual, i.Path, pattern)
+		}
+	case operatorNotEquals:
+		expected := i.format(expectedValues[0])
+		if expected == actual {
+			return fmt.Errorf("value %q at path %q must not equal %q", actual, i.Path, expected)
+		}
+	case operatorOneOf:
+		options := make([]string, 0, len(expectedValues))
+		for _, v := range expectedValues {
+			option := i.format(v)
+			if option == actual {
+				return nil
+			}
+			options = append(options, option)
+		}
+		return fmt.Errorf("value %q at path %q is not one of %q", actual, i.Path, options)
+	case operatorContains:
+		expected := i.format(expectedValues[0])
+		if elements, ok := actualValue.([]interface{}); ok {
+			for _, e := range elements {
+				if fmt.Sprintf("%v", e) == expected {
+					return nil
+				}
+			}
+			return fmt.Errorf("array at path %q does not contain %q", i.Path, expected)
+		}
+		if !strings.Contains(actual, expected) {
+			return fmt.Errorf("value %q at path %q does not contain %q", actual, i.Path, expected)
+		}
+	case operatorStartsWith:
+		expected := i.format(expectedValues[0])
+		if !strings.HasPrefix(actual, expected) {
+			return fmt.Errorf("value %q at path %q does not start with %q", actual, i.Path, expected)
+		}
+	case operatorGt, operatorGte, operatorLt, operatorLte, operatorBetween:
+		return i.checkNumeric(expectedValues, actualValue)
+	default:
+		return fmt.Errorf("unknown constraint operator %q for path %q", i.Operator, i.Path)
+	}
+	return nil
+}
+
+// checkRule checks the value against a pact matching rule using the value of the pact as the example,
+// a path with wildcards resolves to the list of values it matches, each of which must satisfy the rule
+func (i interactionConstraint) checkRule(expectedValues []interface{}, actualValue interface{}) error {
+	var example interface{}
+	if len(expectedValues) > 0 {
+		example = expectedValues[0]
+	}
+
+	if !i.hasWildcard() {
+		if err := i.Rule.check(example, actualValue); err != nil {
+			return fmt.Errorf("value at path %q does not match rule: %w", i.Path, err)
+		}
+		return nil
+	}
+
+	values, _ := actualValue.([]interface{})
+	for n, v := range values {
+		if err := i.Rule.check(example, v); err != nil {
+			return fmt.Errorf("value %d at path %q does not match rule: %w", n, i.Path, err)
+		}
+	}
+	return nil
+}
+
+func (i interactionConstraint) hasWildcard() bool {
+	return strings.Contains(i.Path, "[*]") || strings.Contains(i.Path, ".*")
+}
+
+// isResponse reports whether the constraint is on the response the interaction got from upstream
+func (i interactionConstraint) isResponse() bool {
+	return strings.HasPrefix(i.Path, responseConstraintPrefix)
+}
+
+// isResponseBody reports whether the constraint is on the body of the response, parsed or not
+func (i interactionConstraint) isResponseBody() bool {
+	return strings.HasPrefix(i.Path, responseConstraintPrefix+"body")
+}
+
+func (i interactionConstraint) checkNumeric(expectedValues []interface{}, actualValue interface{}) error {
+	actual, err := toFloat(actualValue)
+	if err != nil {
+		return fmt.Errorf("value %q at path %q is not numeric", fmt.Sprintf("%v", actualValue), i.Path)
+	}
+
+	bounds := make([]float64, len(expectedValues))
+	for n, v := range expectedValues {
+		if bounds[n], err = toFloat(v); err != nil {
+			return fmt.Errorf("expected value %q for path %q is not numeric", fmt.Sprintf("%v", v), i.Path)
+		}
+	}
+
+	var ok bool
+	switch i.Operator {
+	case operatorGt:
+		ok = actual > bounds[0]
+	case operatorGte:
+		ok = actual >= bounds[0]
+	case operatorLt:
+		ok = actual < bounds[0]
+	case operatorLte:
+		ok = actual <= bounds[0]
+	case operatorBetween:
+		ok = actual >= bounds[0] && actual <= bounds[1]
+	}
+	if !ok {
+		return fmt.Errorf("value %v at path %q does not satisfy %s %v", actual, i.Path, i.Operator, bounds)
+	}
+	return nil
+}
+
+// expected describes the value the constraint is looking for, as reported in violations
+func (i interactionConstraint) expected(expectedValues []interface{}) interface{} {
+	switch {
+	case i.Rule != nil:
+		return i.Rule
+	case i.Format == fmtLen && len(expectedValues) == 1:
+		return expectedValues[0]
+	case i.Operator == "":
+		return fmt.Sprintf(i.Format, expectedValues...)
+	case len(expectedValues) == 1:
+		return expectedValues[0]
+	default:
+		return expectedValues
+	}
+}
+
+// format renders a single expected value using the constraint format, defaulting to %v
+func (i interactionConstraint) format(value interface{}) string {
+	if i.Format == "" {
+		return fmt.Sprintf("%v", value)
+	}
+	return fmt.Sprintf(i.Format, value)
+}
+
+func toFloat(value interface{}) (float64, error) {
+	switch v := value.(type) {
+	case float64:
+		return v, nil
+	case float32:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case json.Number:
+		return v.Float64()
+	case string:
+		return strconv.ParseFloat(strings.TrimSpace(v), 64)
+	default:
+		return 0, fmt.Errorf("%v is not a number", value)
+	}
+}
@@ -0,0 +1,184 @@
+package pactproxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConstraintOperators(t *testing.T) {
+	tests := []struct {
+		name       string
+		constraint interactionConstraint
+		actual     interface{}
+		wantErr    bool
+	}{
+		{
+			name:       "regex matches",
+			constraint: interactionConstraint{Path: "$.body.id", Operator: operatorRegex, Values: []interface{}{"^[0-9a-f]{4}$"}},
+			actual:     "a1b2",
+		},
+		{
+			name:       "regex does not match",
+			constraint: interactionConstraint{Path: "$.body.id", Operator: operatorRegex, Values: []interface{}{"^[0-9a-f]{4}$"}},
+			actual:     "zzzz",
+			wantErr:    true,
+		},
+		{
+			name:       "not equals",
+			constraint: interactionConstraint{Path: "$.body.name", Operator: operatorNotEquals, Values: []interface{}{"sam"}},
+			actual:     "jane",
+		},
+		{
+			name:       "not equals with equal value",
+			constraint: interactionConstraint{Path: "$.body.name", Operator: operatorNotEquals, Values: []interface{}{"sam"}},
+			actual:     "sam",
+			wantErr:    true,
+		},
+		{
+			name:       "one of",
+			constraint: interactionConstraint{Path: "$.body.currency", Operator: operatorOneOf, Values: []interface{}{"GBP", "EUR"}},
+			actual:     "EUR",
+		},
+		{
+			name:       "not one of",
+			constraint: interactionConstraint{Path: "$.body.currency", Operator: operatorOneOf, Values: []interface{}{"GBP", "EUR"}},
+			actual:     "USD",
+			wantErr:    true,
+		},
+		{
+			name:       "string contains",
+			constraint: interactionConstraint{Path: "$.body.reference", Operator: operatorContains, Values: []interface{}{"INV"}},
+			actual:     "REF-INV-001",
+		},
+		{
+			name:       "array contains",
+			constraint: interactionConstraint{Path: "$.body.tags", Operator: operatorContains, Values: []interface{}{"urgent"}},
+			actual:     []interface{}{"normal", "urgent"},
+		},
+		{
+			name:       "array does not contain",
+			constraint: interactionConstraint{Path: "$.body.tags", Operator: operatorContains, Values: []interface{}{"urgent"}},
+			actual:     []interface{}{"normal"},
+			wantErr:    true,
+		},
+		{
+			name:       "starts with",
+			constraint: interactionConstraint{Path: "$.path", Operator: operatorStartsWith, Values: []interface{}{"/v1/"}},
+			actual:     "/v1/payments",
+		},
+		{
+			name:       "does not start with",
+			constraint: interactionConstraint{Path: "$.path", Operator: operatorStartsWith, Values: []interface{}{"/v2/"}},
+			actual:     "/v1/payments",
+			wantErr:    true,
+		},
+		{
+			name:       "greater than",
+			constraint: interactionConstraint{Path: "$.body.amount", Operator: operatorGt, Values: []interface{}{0}},
+			actual:     10.5,
+		},
+		{
+			name:       "greater than with string value",
+			constraint: interactionConstraint{Path: "$.query.amount", Operator: operatorGt, Values: []interface{}{"0"}},
+			actual:     "0",
+			wantErr:    true,
+		},
+		{
+			name:       "greater than or equal",
+			constraint: interactionConstraint{Path: "$.body.amount", Operator: operatorGte, Values: []interface{}{10.0}},
+			actual:     10.0,
+		},
+		{
+			name:       "less than",
+			constraint: interactionConstraint{Path: "$.body.amount", Operator: operatorLt, Values: []interface{}{10.0}},
+			actual:     10.0,
+			wantErr:    true,
+		},
+		{
+			name:       "less than or equal",
+			constraint: interactionConstraint{Path: "$.body.amount", Operator: operatorLte, Values: []interface{}{10.0}},
+			actual:     10.0,
+		},
+		{
+			name:       "between",
+			constraint: interactionConstraint{Path: "$.body.amount", Operator: operatorBetween, Values: []interface{}{1.0, 100.0}},
+			actual:     50.0,
+		},
+		{
+			name:       "not between",
+			constraint: interactionConstraint{Path: "$.body.amount", Operator: operatorBetween, Values: []interface{}{1.0, 100.0}},
+			actual:     150.0,
+			wantErr:    true,
+		},
+		{
+			name:       "numeric operator on non numeric value",
+			constraint: interactionConstraint{Path: "$.body.amount", Operator: operatorGt, Values: []interface{}{1.0}},
+			actual:     "lots",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.constraint.check(tt.constraint.Values, tt.actual)
+			assert.Equalf(t, tt.wantErr, err != nil, "error %v", err)
+		})
+	}
+}
+
+func TestConstraintValidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		constraint interactionConstraint
+		wantErr    bool
+	}{
+		{
+			name:       "no operator",
+			constraint: interactionConstraint{Path: "$.body.name", Format: "%s", Values: []interface{}{"sam"}},
+		},
+		{
+			name:       "unknown operator",
+			constraint: interactionConstraint{Path: "$.body.name", Operator: "like", Values: []interface{}{"sam"}},
+			wantErr:    true,
+		},
+		{
+			name:       "invalid regex",
+			constraint: interactionConstraint{Path: "$.body.name", Operator: operatorRegex, Values: []interface{}{"("}},
+			wantErr:    true,
+		},
+		{
+			name:       "between with a single value",
+			constraint: interactionConstraint{Path: "$.body.amount", Operator: operatorBetween, Values: []interface{}{1.0}},
+			wantErr:    true,
+		},
+		{
+			name:       "numeric operator with non numeric value",
+			constraint: interactionConstraint{Path: "$.body.amount", Operator: operatorLt, Values: []interface{}{"ten"}},
+			wantErr:    true,
+		},
+		{
+			name: "numeric operator with source",
+			constraint: interactionConstraint{
+				Path: "$.body.amount", Operator: operatorLt, Source: "other", Values: []interface{}{"$.body.limit"},
+			},
+		},
+		{
+			name: "source with a value that is not a path",
+			constraint: interactionConstraint{
+				Path: "$.body.amount", Source: "other", Values: []interface{}{10.0},
+			},
+			wantErr: true,
+		},
+		{
+			name:       "one of without values",
+			constraint: interactionConstraint{Path: "$.body.currency", Operator: operatorOneOf},
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.constraint.validate()
+			assert.Equalf(t, tt.wantErr, err != nil, "error %v", err)
+		})
+	}
+}
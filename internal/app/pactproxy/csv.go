@@ -0,0 +1,125 @@
+package pactproxy
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// csvBody is the key of the parsed CSV body in request and response documents, "$.body" stays the text of the body
+// which the constraints of the pact and constraints on the whole body compare against
+const csvBody = "body_csv"
+
+// ParseCSVRequest keeps a CSV body as text in "$.body" and parses it into "$.body_csv.rows", keyed by the column
+// names of the header row, and "$.body_csv.columns". A body that is not valid CSV has no "$.body_csv", so it is
+// rejected by constraints rather than by the parser.
+func ParseCSVRequest(data []byte, url *url.URL, _ map[string]string) (requestDocument, error) {
+	request := newRequestDocument(url, string(data))
+	if body, err := parseCSVBody(data); err == nil {
+		request[csvBody] = body
+	}
+	return request, nil
+}
+
+func parseCSVBody(data []byte) (map[string]interface{}, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	columns, err := reader.Read()
+	if err == io.EOF {
+		return map[string]interface{}{"columns": []interface{}{}, "rows": []interface{}{}}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows := make([]interface{}, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]interface{}, len(columns))
+		for n, column := range columns {
+			row[column] = record[n]
+		}
+		rows = append(rows, row)
+	}
+
+	return map[string]interface{}{
+		"columns": toInterfaces(columns),
+		"rows":    rows,
+	}, nil
+}
+
+var csvIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// csvColumnPath addresses a column of a row, quoting column names that are not valid json path identifiers
+func csvColumnPath(row, column string) string {
+	if csvIdentifier.MatchString(column) {
+		return row + "." + column
+	}
+	return row + `["` + column + `"]`
+}
+
+var csvColumnRule = regexp.MustCompile(`^\$\.body\.?(?:rows\[[^\]]*\]\.|column:)?(.+)$`)
+
+// csvColumnRules finds the matching rules of the columns, which can be given for the column name, e.g.
+// "$.body.amount" or "$.body.rows[*].amount", or as in the pact csv plugin for the column name or its position
+// starting at 1, e.g. "column:amount" or "column:2"
+func csvColumnRules(rules pactRules, columns []interface{}) map[string]matchingRule {
+	result := map[string]matchingRule{}
+	for path, rule := range rules {
+		match := csvColumnRule.FindStringSubmatch(path)
+		if match == nil {
+			continue
+		}
+		column := strings.Trim(match[1], `'"[]`)
+		if position, err := strconv.Atoi(column); err == nil && position > 0 && position <= len(columns) {
+			column = fmt.Sprintf("%v", columns[position-1])
+		}
+		result[column] = rule
+	}
+	return result
+}
+
+// This function adds constraints for the number of rows of a CSV request body and for every value in it. Values
+// which do not have a matching rule for their column must equal the pact, those which do must satisfy the rule.
+// A rule for the whole body applies to its text.
+func (i *Interaction) addCSVConstraintsFromPact(rules pactRules, text string, body map[string]interface{}) {
+	if rule, hasRule := rules["$.body"]; hasRule {
+		i.addRuleConstraint("$.body", rule, text)
+		return
+	}
+
+	columns, _ := body["columns"].([]interface{})
+	rows, _ := body["rows"].([]interface{})
+	columnRules := csvColumnRules(rules, columns)
+
+	i.AddConstraint(interactionConstraint{
+		Path:   "$." + csvBody + ".rows",
+		Format: fmtLen,
+		Values: []interface{}{len(rows)},
+	})
+	for n, row := range rows {
+		for column, value := range row.(map[string]interface{}) {
+			path := csvColumnPath(fmt.Sprintf("$.%s.rows[%d]", csvBody, n), column)
+			if rule, hasRule := columnRules[column]; hasRule {
+				i.addRuleConstraint(path, rule, value)
+				continue
+			}
+			i.AddConstraint(interactionConstraint{
+				Path:   path,
+				Format: "%v",
+				Values: []interface{}{value},
+			})
+		}
+	}
+}
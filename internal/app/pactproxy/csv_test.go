@@ -0,0 +1,156 @@
+package pactproxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCSVBody(t *testing.T) {
+	body, err := parseCSVBody([]byte("name,amount\nfoo,10\nbar,20\n"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"columns": []interface{}{"name", "amount"},
+		"rows": []interface{}{
+			map[string]interface{}{"name": "foo", "amount": "10"},
+			map[string]interface{}{"name": "bar", "amount": "20"},
+		},
+	}, body)
+
+	_, err = parseCSVBody([]byte("name,amount\nfoo\n"))
+	assert.Error(t, err)
+}
+
+func TestLoadInteractionCSVConstraints(t *testing.T) {
+	tests := []struct {
+		name            string
+		matchingRules   string
+		wantConstraints []interactionConstraint
+		wantRulePaths   []string
+	}{
+		{
+			name: "no matching rules",
+			wantConstraints: []interactionConstraint{
+				{Path: "$.body_csv.rows", Format: fmtLen, Values: []interface{}{2}},
+				{Path: "$.body_csv.rows[0].name", Format: "%v", Values: []interface{}{"foo"}},
+				{Path: `$.body_csv.rows[0]["unit price"]`, Format: "%v", Values: []interface{}{"10"}},
+				{Path: "$.body_csv.rows[1].name", Format: "%v", Values: []interface{}{"bar"}},
+				{Path: `$.body_csv.rows[1]["unit price"]`, Format: "%v", Values: []interface{}{"20"}},
+			},
+		},
+		{
+			name:          "v2 rule for every row of a column",
+			matchingRules: `{"$.body.rows[*].name": {"match": "type"}}`,
+			wantConstraints: []interactionConstraint{
+				{Path: "$.body_csv.rows", Format: fmtLen, Values: []interface{}{2}},
+				{Path: `$.body_csv.rows[0]["unit price"]`, Format: "%v", Values: []interface{}{"10"}},
+				{Path: `$.body_csv.rows[1]["unit price"]`, Format: "%v", Values: []interface{}{"20"}},
+			},
+			wantRulePaths: []string{"$.body_csv.rows[0].name", "$.body_csv.rows[1].name"},
+		},
+		{
+			name:          "v3 rule for a column position",
+			matchingRules: `{"body": {"column:2": {"matchers": [{"match": "number"}]}}}`,
+			wantConstraints: []interactionConstraint{
+				{Path: "$.body_csv.rows", Format: fmtLen, Values: []interface{}{2}},
+				{Path: "$.body_csv.rows[0].name", Format: "%v", Values: []interface{}{"foo"}},
+				{Path: "$.body_csv.rows[1].name", Format: "%v", Values: []interface{}{"bar"}},
+			},
+			wantRulePaths: []string{`$.body_csv.rows[0]["unit price"]`, `$.body_csv.rows[1]["unit price"]`},
+		},
+		{
+			name:          "v3 rule for the whole body",
+			matchingRules: `{"body": {"$": {"matchers": [{"match": "regex", "regex": "^name,unit price\\n"}]}}}`,
+			wantRulePaths: []string{"$.body"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matchingRules := ""
+			if tt.matchingRules != "" {
+				matchingRules = `, "matchingRules": ` + tt.matchingRules
+			}
+			definition := `{
+				"description": "A request to upload prices",
+				"request": {
+				  "method": "POST",
+				  "path": "/prices",
+				  "headers": {"Content-Type": "text/csv"},
+				  "body": "name,unit price\nfoo,10\nbar,20"` + matchingRules + `
+				}
+			}`
+
+			interaction, err := LoadInteraction([]byte(definition), "alias")
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantConstraints, exactConstraints(interaction))
+
+			var rulePaths []string
+			for _, constraint := range interaction.Constraints() {
+				if constraint.Rule != nil {
+					rulePaths = append(rulePaths, constraint.Path)
+				}
+			}
+			assert.Equal(t, tt.wantRulePaths, rulePaths)
+		})
+	}
+}
+
+func TestCSVRequestConstraints(t *testing.T) {
+	i := newRoutedInteraction("upload-prices", http.MethodPost, "/prices")
+	i.AddConstraint(interactionConstraint{Interaction: "upload-prices", Path: "$.body_csv.rows", Format: fmtLen, Values: []interface{}{2}})
+	i.AddConstraint(interactionConstraint{Interaction: "upload-prices", Path: `$.body_csv.rows[1]["unit price"]`, Operator: operatorGt, Values: []interface{}{15}})
+
+	a := newTestAPI(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}, i)
+
+	for body, expected := range map[string]int{
+		"name,unit price\nfoo,10\nbar,20":         http.StatusNoContent,
+		"name,unit price\nfoo,10\nbar":            http.StatusBadRequest,
+		"name,unit price\nfoo,10\nbar,5":          http.StatusBadRequest,
+		"name,unit price\nfoo,10\nbar,20\nbaz,30": http.StatusBadRequest,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/prices", strings.NewReader(body))
+		req.Header.Set("Content-Type", "text/csv")
+		rec := httptest.NewRecorder()
+		require.NoError(t, a.indexHandler(echo.New().NewContext(req, rec)))
+		assert.Equalf(t, expected, rec.Code, "body %q", body)
+	}
+}
+
+func TestCSVColumnRulesAreEnforced(t *testing.T) {
+	definition := `{
+		"description": "A request to upload prices",
+		"request": {
+		  "method": "POST",
+		  "path": "/prices",
+		  "headers": {"Content-Type": "text/csv"},
+		  "body": "name,unit price\nfoo,10\nbar,20",
+		  "matchingRules": {"body": {"column:2": {"matchers": [{"match": "regex", "regex": "^\\d+$"}]}}}
+		}
+	}`
+	i, err := LoadInteraction([]byte(definition), "upload-prices")
+	require.NoError(t, err)
+
+	a := newTestAPI(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}, i)
+
+	for body, expected := range map[string]int{
+		"name,unit price\nfoo,10\nbar,20":  http.StatusNoContent,
+		"name,unit price\nfoo,99\nbar,5":   http.StatusNoContent,
+		"name,unit price\nfoo,10\nbar,abc": http.StatusBadRequest,
+		"name,unit price\nfoo,10\nbaz,20":  http.StatusBadRequest,
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/prices", strings.NewReader(body))
+		req.Header.Set("Content-Type", "text/csv")
+		rec := httptest.NewRecorder()
+		require.NoError(t, a.indexHandler(echo.New().NewContext(req, rec)))
+		assert.Equalf(t, expected, rec.Code, "body %q", body)
+	}
+}
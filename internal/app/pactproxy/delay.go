@@ -0,0 +1,96 @@
+package pactproxy
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+const delayHang = "hang"
+
+// responseDelay holds a response back for a fixed duration, a random duration between min and max,
+// or until the client disconnects when hang is set
+type responseDelay struct {
+	min  time.Duration
+	max  time.Duration
+	hang bool
+}
+
+// parseDelay reads a "$.delay" modifier value, which is either "hang", a duration such as "500ms",
+// a number of milliseconds, or an object with "min" and "max" durations
+func parseDelay(value interface{}) (responseDelay, error) {
+	switch v := value.(type) {
+	case string:
+		if v == delayHang {
+			return responseDelay{hang: true}, nil
+		}
+		d, err := parseDelayDuration(v)
+		if err != nil {
+			return responseDelay{}, err
+		}
+		return responseDelay{min: d, max: d}, nil
+	case float64:
+		d, err := parseDelayDuration(v)
+		if err != nil {
+			return responseDelay{}, err
+		}
+		return responseDelay{min: d, max: d}, nil
+	case map[string]interface{}:
+		lower, err := parseDelayDuration(v["min"])
+		if err != nil {
+			return responseDelay{}, fmt.Errorf("invalid min delay: %w", err)
+		}
+		upper, err := parseDelayDuration(v["max"])
+		if err != nil {
+			return responseDelay{}, fmt.Errorf("invalid max delay: %w", err)
+		}
+		if upper < lower {
+			return responseDelay{}, fmt.Errorf("max delay %s is less than min delay %s", upper, lower)
+		}
+		return responseDelay{min: lower, max: upper}, nil
+	default:
+		return responseDelay{}, fmt.Errorf("unsupported delay value %v", value)
+	}
+}
+
+func parseDelayDuration(value interface{}) (time.Duration, error) {
+	var d time.Duration
+	switch v := value.(type) {
+	case string:
+		var err error
+		if d, err = time.ParseDuration(v); err != nil {
+			return 0, err
+		}
+	case float64:
+		d = time.Duration(v * float64(time.Millisecond))
+	default:
+		return 0, fmt.Errorf("unsupported duration %v", value)
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration %s", d)
+	}
+	return d, nil
+}
+
+func (d responseDelay) duration() time.Duration {
+	if d.max <= d.min {
+		return d.min
+	}
+	return d.min + time.Duration(rand.Int63n(int64(d.max-d.min)+1))
+}
+
+// wait blocks until the delay has passed or ctx is done
+func (d responseDelay) wait(ctx context.Context) {
+	if d.hang {
+		<-ctx.Done()
+		return
+	}
+
+	timer := time.NewTimer(d.duration())
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
@@ -0,0 +1,85 @@
+package pactproxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseDelay(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   interface{}
+		want    responseDelay
+		wantErr bool
+	}{
+		{
+			name:  "duration string",
+			value: "250ms",
+			want:  responseDelay{min: 250 * time.Millisecond, max: 250 * time.Millisecond},
+		},
+		{
+			name:  "milliseconds",
+			value: float64(1500),
+			want:  responseDelay{min: 1500 * time.Millisecond, max: 1500 * time.Millisecond},
+		},
+		{
+			name:  "range",
+			value: map[string]interface{}{"min": "1s", "max": float64(2000)},
+			want:  responseDelay{min: time.Second, max: 2 * time.Second},
+		},
+		{
+			name:  "hang",
+			value: "hang",
+			want:  responseDelay{hang: true},
+		},
+		{
+			name:    "range with max less than min",
+			value:   map[string]interface{}{"min": "2s", "max": "1s"},
+			wantErr: true,
+		},
+		{
+			name:    "negative duration",
+			value:   "-1s",
+			wantErr: true,
+		},
+		{
+			name:    "invalid duration",
+			value:   "soon",
+			wantErr: true,
+		},
+		{
+			name:    "unsupported type",
+			value:   true,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseDelay(tt.value)
+			require.Equalf(t, tt.wantErr, err != nil, "error %v", err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestResponseDelayDuration(t *testing.T) {
+	d := responseDelay{min: 10 * time.Millisecond, max: 20 * time.Millisecond}
+	for n := 0; n < 100; n++ {
+		got := d.duration()
+		assert.GreaterOrEqual(t, got, d.min)
+		assert.LessOrEqual(t, got, d.max)
+	}
+}
+
+func TestResponseDelayHangReturnsWhenContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	responseDelay{hang: true}.wait(ctx)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+}
@@ -0,0 +1,59 @@
+package pactproxy
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+const (
+	faultConnectionReset       = "connection_reset"
+	faultEmptyReply            = "empty_reply"
+	faultTruncatedBody         = "truncated_body"
+	faultContentLengthMismatch = "content_length_mismatch"
+)
+
+func validateFault(value interface{}) error {
+	switch value {
+	case faultConnectionReset, faultEmptyReply, faultTruncatedBody, faultContentLengthMismatch:
+		return nil
+	}
+	return fmt.Errorf("unsupported fault %v", value)
+}
+
+// closeConnection flushes anything written so far and closes the underlying connection of w.
+// When reset is set the connection is closed with a TCP RST instead of a FIN.
+func closeConnection(w http.ResponseWriter, reset bool) error {
+	for {
+		u, ok := w.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		w = u.Unwrap()
+	}
+
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	h, ok := w.(http.Hijacker)
+	if !ok {
+		return fmt.Errorf("response writer %T does not support hijacking", w)
+	}
+	conn, _, err := h.Hijack()
+	if err != nil {
+		return err
+	}
+
+	if reset {
+		c := conn
+		if tlsConn, ok := c.(*tls.Conn); ok {
+			c = tlsConn.NetConn()
+		}
+		if tcpConn, ok := c.(*net.TCPConn); ok {
+			_ = tcpConn.SetLinger(0)
+		}
+	}
+	return conn.Close()
+}
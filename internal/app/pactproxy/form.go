@@ -0,0 +1,103 @@
+package pactproxy
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/url"
+
+	"github.com/pkg/errors"
+)
+
+// ParseFormRequest parses an url-encoded form into "$.body", holding the first value of each field,
+// and "$.body_values", holding all of them
+func ParseFormRequest(data []byte, url *url.URL, _ map[string]string) (requestDocument, error) {
+	body, bodyValues, err := parseFormBody(data)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse RequestDocument form body")
+	}
+
+	request := newRequestDocument(url, body)
+	request["body_values"] = bodyValues
+	return request, nil
+}
+
+// ParseMultipartRequest parses a multipart form into "$.body", a field holds its value unless the part is a file,
+// in which case it holds the file name, content type and size of the part
+func ParseMultipartRequest(data []byte, url *url.URL, params map[string]string) (requestDocument, error) {
+	body, err := parseMultipartBody(data, params["boundary"])
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse RequestDocument multipart body")
+	}
+	return newRequestDocument(url, body), nil
+}
+
+func parseFormBody(data []byte) (map[string]interface{}, map[string]interface{}, error) {
+	values, err := url.ParseQuery(string(data))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body := make(map[string]interface{})
+	bodyValues := make(map[string]interface{})
+	for field, v := range values {
+		if len(v) > 0 {
+			escapeValue(body, field, v[0])
+			escapeValue(bodyValues, field, toInterfaces(v))
+		}
+	}
+	return body, bodyValues, nil
+}
+
+func parseMultipartBody(data []byte, boundary string) (map[string]interface{}, error) {
+	if boundary == "" {
+		return nil, errors.New("multipart boundary is missing")
+	}
+
+	body := make(map[string]interface{})
+	reader := multipart.NewReader(bytes.NewReader(data), boundary)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return body, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+
+		name := part.FormName()
+		if _, exists := body[name]; exists || name == "" {
+			continue
+		}
+
+		if part.FileName() == "" {
+			body[name] = string(content)
+			continue
+		}
+		body[name] = map[string]interface{}{
+			"filename":     part.FileName(),
+			"content_type": part.Header.Get("Content-Type"),
+			"size":         len(content),
+		}
+	}
+}
+
+// This function adds constraints for the fields of a multipart request body, which must equal the pact
+// or satisfy their matching rule. The content of uploaded files is not constrained, only their file name.
+func (i *Interaction) addMultipartConstraintsFromPact(rules pactRules, body map[string]interface{}) {
+	for field, value := range body {
+		path := "$.body." + field
+		if file, ok := value.(map[string]interface{}); ok {
+			if !rules.has(path) {
+				i.addJSONConstraintsFromPact(path+".filename", rules, file["filename"], false)
+			}
+			continue
+		}
+		i.addJSONConstraintsFromPact(path, rules, value, false)
+	}
+}
@@ -0,0 +1,303 @@
+package pactproxy
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"regexp"
+	"regexp/syntax"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	generatorRandomInt         = "RandomInt"
+	generatorRandomDecimal     = "RandomDecimal"
+	generatorRandomHexadecimal = "RandomHexadecimal"
+	generatorRandomString      = "RandomString"
+	generatorRandomBoolean     = "RandomBoolean"
+	generatorRegex             = "Regex"
+	generatorUUID              = "Uuid"
+	generatorDate              = "Date"
+	generatorTime              = "Time"
+	generatorDateTime          = "DateTime"
+	generatorProviderState     = "ProviderState"
+	generatorMockServerURL     = "MockServerURL"
+)
+
+var knownGenerators = map[string]bool{
+	generatorRandomInt:         true,
+	generatorRandomDecimal:     true,
+	generatorRandomHexadecimal: true,
+	generatorRandomString:      true,
+	generatorRandomBoolean:     true,
+	generatorRegex:             true,
+	generatorUUID:              true,
+	generatorDate:              true,
+	generatorTime:              true,
+	generatorDateTime:          true,
+	generatorProviderState:     true,
+	generatorMockServerURL:     true,
+}
+
+// pactGenerator generates a value in place of the value of the pact, e.g. {"type": "RandomInt", "min": 0, "max": 10}
+type pactGenerator map[string]interface{}
+
+func (g pactGenerator) generatorType() string {
+	t, _ := g["type"].(string)
+	return t
+}
+
+// pactGenerators holds the generators of a pact request or response by the path of the value they generate,
+// e.g. "$.body.id", "$.path", "$.status", "$.query.page" or "$.headers.Location"
+type pactGenerators map[string]pactGenerator
+
+// newPactGenerators reads the generators of a v3 or v4 pact, which are grouped by category:
+// {"body": {"$.id": {...}}, "path": {...}, "status": {...}, "query": {"page": {...}}, "header": {"Location": {...}}}
+func newPactGenerators(value interface{}) (pactGenerators, error) {
+	generators := pactGenerators{}
+	if value == nil {
+		return generators, nil
+	}
+	categories, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("generators must be an object, got %T", value)
+	}
+
+	add := func(path string, value interface{}) error {
+		generator, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("generator for %s must be an object, got %T", path, value)
+		}
+		if !knownGenerators[pactGenerator(generator).generatorType()] {
+			return fmt.Errorf("unknown generator %q for %s", pactGenerator(generator).generatorType(), path)
+		}
+		generators[path] = generator
+		return nil
+	}
+
+	for category, entries := range categories {
+		switch category {
+		case "path", "status":
+			if err := add("$."+category, entries); err != nil {
+				return nil, err
+			}
+		case "body", "query", "header":
+			named, ok := entries.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("%s generators must be an object, got %T", category, entries)
+			}
+			for name, generator := range named {
+				var path string
+				switch category {
+				case "body":
+					path = "$.body" + strings.TrimPrefix(name, "$")
+				case "query":
+					path = ruleChildPath("$.query", name)
+				case "header":
+					path = ruleChildPath("$.headers", canonicalHeaderName(name))
+				}
+				if err := add(path, generator); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return generators, nil
+}
+
+// generatorContext holds what generators need to know about the response being generated
+type generatorContext struct {
+	// mockServerURL is the base URL the consumer reached the proxy at, e.g. "http://localhost:8080"
+	mockServerURL string
+}
+
+// generate returns a value generated in place of the example of the pact. ProviderState generators,
+// which are only applied by the provider, keep the example.
+func (g pactGenerator) generate(example interface{}, ctx generatorContext) (interface{}, error) {
+	switch g.generatorType() {
+	case generatorRandomInt:
+		min, max := g.intParam("min", 0), g.intParam("max", math.MaxInt32)
+		if max < min {
+			return nil, fmt.Errorf("RandomInt generator has a max of %d below its min of %d", max, min)
+		}
+		return min + rand.Intn(max-min+1), nil
+	case generatorRandomDecimal:
+		digits := g.intParam("digits", 10)
+		if digits < 2 {
+			digits = 2
+		}
+		// neither the first nor the last digit is a zero, so that the number keeps all of its digits
+		value := randomString(1, "123456789") + randomString(digits-2, "0123456789") + randomString(1, "123456789")
+		point := 1 + rand.Intn(digits-1)
+		return strconv.ParseFloat(value[:point]+"."+value[point:], 64)
+	case generatorRandomHexadecimal:
+		return randomString(g.intParam("digits", 10), "0123456789abcdef"), nil
+	case generatorRandomString:
+		return randomString(g.intParam("size", 20), "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"), nil
+	case generatorRandomBoolean:
+		return rand.Intn(2) == 1, nil
+	case generatorRegex:
+		pattern, _ := g["regex"].(string)
+		return generateFromRegex(pattern)
+	case generatorUUID:
+		id, err := newUUID()
+		if err != nil {
+			return nil, err
+		}
+		switch g["format"] {
+		case "simple":
+			return strings.ReplaceAll(id, "-", ""), nil
+		case "upper-case-hyphenated":
+			return strings.ToUpper(id), nil
+		case "URN":
+			return "urn:uuid:" + id, nil
+		}
+		return id, nil
+	case generatorDate, generatorTime, generatorDateTime:
+		return g.generateDateTime(), nil
+	case generatorMockServerURL:
+		return g.generateMockServerURL(example, ctx)
+	}
+	return example, nil
+}
+
+func (g pactGenerator) intParam(name string, fallback int) int {
+	if value, err := toFloat(g[name]); err == nil {
+		return int(value)
+	}
+	return fallback
+}
+
+var defaultGeneratorFormats = map[string]string{
+	generatorDate:     "yyyy-MM-dd",
+	generatorTime:     "HH:mm:ss",
+	generatorDateTime: "yyyy-MM-dd'T'HH:mm:ss",
+}
+
+func (g pactGenerator) generateDateTime() string {
+	format, _ := g["format"].(string)
+	if format == "" {
+		format = defaultGeneratorFormats[g.generatorType()]
+	}
+	return time.Now().Format(javaDateTimeLayout(format))
+}
+
+// generateMockServerURL replaces the base URL of the example with that of the mock server, the regex of the
+// generator matches the example and captures the parts of it that are kept, e.g. ".*(/payments/\d+)$"
+func (g pactGenerator) generateMockServerURL(example interface{}, ctx generatorContext) (interface{}, error) {
+	value, _ := g["example"].(string)
+	if s, ok := example.(string); ok && s != "" {
+		value = s
+	}
+	pattern, _ := g["regex"].(string)
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid MockServerURL generator regex")
+	}
+	match := re.FindStringSubmatch(value)
+	if match == nil {
+		return value, nil
+	}
+	return ctx.mockServerURL + strings.Join(match[1:], ""), nil
+}
+
+func randomString(length int, alphabet string) string {
+	b := make([]byte, length)
+	for n := range b {
+		b[n] = alphabet[rand.Intn(len(alphabet))]
+	}
+	return string(b)
+}
+
+// generateFromRegex generates a random string the regex matches
+func generateFromRegex(pattern string) (string, error) {
+	re, err := syntax.Parse(pattern, syntax.Perl)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid Regex generator regex")
+	}
+	var b strings.Builder
+	writeRegexMatch(&b, re.Simplify())
+	return b.String(), nil
+}
+
+const maxRegexRepeat = 3
+
+func writeRegexMatch(b *strings.Builder, re *syntax.Regexp) {
+	switch re.Op {
+	case syntax.OpLiteral:
+		b.WriteString(string(re.Rune))
+	case syntax.OpCharClass:
+		if len(re.Rune) == 0 {
+			return
+		}
+		pair := rand.Intn(len(re.Rune)/2) * 2
+		lo, hi := re.Rune[pair], re.Rune[pair+1]
+		// keep to printable ASCII where the class allows it
+		if lo < ' ' && hi >= ' ' {
+			lo = ' '
+		}
+		if hi > '~' && lo <= '~' {
+			hi = '~'
+		}
+		b.WriteRune(lo + rune(rand.Intn(int(hi-lo)+1)))
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		b.WriteByte(byte('a' + rand.Intn(26)))
+	case syntax.OpCapture:
+		writeRegexMatch(b, re.Sub[0])
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			writeRegexMatch(b, sub)
+		}
+	case syntax.OpAlternate:
+		writeRegexMatch(b, re.Sub[rand.Intn(len(re.Sub))])
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest, syntax.OpRepeat:
+		min, max := re.Min, re.Max
+		switch re.Op {
+		case syntax.OpStar:
+			min, max = 0, maxRegexRepeat
+		case syntax.OpPlus:
+			min, max = 1, maxRegexRepeat
+		case syntax.OpQuest:
+			min, max = 0, 1
+		}
+		if max < 0 {
+			max = min + maxRegexRepeat
+		}
+		for n := min + rand.Intn(max-min+1); n > 0; n-- {
+			writeRegexMatch(b, re.Sub[0])
+		}
+	}
+}
+
+// applyGenerator replaces the values at the path, which may have wildcards, with generated values
+func applyGenerator(value interface{}, segments []string, generate func(interface{}) (interface{}, error)) (interface{}, error) {
+	if len(segments) == 0 {
+		return generate(value)
+	}
+
+	segment, rest := segments[0], segments[1:]
+	var err error
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if segment == "*" || segment == key {
+				if v[key], err = applyGenerator(child, rest, generate); err != nil {
+					return nil, err
+				}
+			}
+		}
+	case []interface{}:
+		for n, child := range v {
+			if segment == "[*]" || segment == fmt.Sprintf("[%d]", n) {
+				if v[n], err = applyGenerator(child, rest, generate); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,117 @@
+package pactproxy
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPactGeneratorGenerate(t *testing.T) {
+	ctx := generatorContext{mockServerURL: "http://localhost:8080"}
+	tests := []struct {
+		name      string
+		generator pactGenerator
+		example   interface{}
+		check     func(t *testing.T, value interface{})
+	}{
+		{
+			name:      "random int within bounds",
+			generator: pactGenerator{"type": "RandomInt", "min": 5.0, "max": 7.0},
+			check: func(t *testing.T, value interface{}) {
+				assert.GreaterOrEqual(t, value, 5)
+				assert.LessOrEqual(t, value, 7)
+			},
+		},
+		{
+			name:      "random decimal keeps its digits",
+			generator: pactGenerator{"type": "RandomDecimal", "digits": 6.0},
+			check: func(t *testing.T, value interface{}) {
+				assert.Regexp(t, `^\d{6}$`, strings.Replace(strconv.FormatFloat(value.(float64), 'f', -1, 64), ".", "", 1))
+			},
+		},
+		{
+			name:      "random hexadecimal",
+			generator: pactGenerator{"type": "RandomHexadecimal", "digits": 8.0},
+			check: func(t *testing.T, value interface{}) {
+				assert.Regexp(t, `^[0-9a-f]{8}$`, value)
+			},
+		},
+		{
+			name:      "random string",
+			generator: pactGenerator{"type": "RandomString", "size": 4.0},
+			check: func(t *testing.T, value interface{}) {
+				assert.Len(t, value, 4)
+			},
+		},
+		{
+			name:      "regex",
+			generator: pactGenerator{"type": "Regex", "regex": `PAY-\d{4}-[A-Z]+`},
+			check: func(t *testing.T, value interface{}) {
+				assert.Regexp(t, `^PAY-\d{4}-[A-Z]+$`, value)
+			},
+		},
+		{
+			name:      "simple uuid",
+			generator: pactGenerator{"type": "Uuid", "format": "simple"},
+			check: func(t *testing.T, value interface{}) {
+				assert.Regexp(t, `^[0-9a-f]{32}$`, value)
+			},
+		},
+		{
+			name:      "date with format",
+			generator: pactGenerator{"type": "Date", "format": "dd/MM/yyyy"},
+			check: func(t *testing.T, value interface{}) {
+				assert.Equal(t, time.Now().Format("02/01/2006"), value)
+			},
+		},
+		{
+			name:      "mock server url",
+			generator: pactGenerator{"type": "MockServerURL", "example": "http://example.com/payments/1", "regex": `.*(/payments/\d+)$`},
+			example:   "http://example.com/payments/1",
+			check: func(t *testing.T, value interface{}) {
+				assert.Equal(t, "http://localhost:8080/payments/1", value)
+			},
+		},
+		{
+			name:      "provider state keeps the example",
+			generator: pactGenerator{"type": "ProviderState", "expression": "${id}"},
+			example:   "1",
+			check: func(t *testing.T, value interface{}) {
+				assert.Equal(t, "1", value)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, err := tt.generator.generate(tt.example, ctx)
+			require.NoError(t, err)
+			tt.check(t, value)
+		})
+	}
+}
+
+func TestApplyGenerator(t *testing.T) {
+	body := map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"id": "a", "name": "x"},
+			map[string]interface{}{"id": "b", "name": "y"},
+		},
+	}
+
+	generated, err := applyGenerator(body, pathSegments("$.items[*].id"), func(example interface{}) (interface{}, error) {
+		return example.(string) + "1", nil
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]interface{}{
+		"items": []interface{}{
+			map[string]interface{}{"id": "a1", "name": "x"},
+			map[string]interface{}{"id": "b1", "name": "y"},
+		},
+	}, generated)
+}
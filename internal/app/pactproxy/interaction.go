@@ -1,10 +1,14 @@
 package pactproxy
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"mime"
+	"net/http"
+	"net/url"
 	"regexp"
+	"sort"
 	"strings"
 	"sync"
 
@@ -14,13 +18,18 @@ import (
 )
 
 const (
-	mediaTypeJSON    = "application/json"
-	mediaTypeJSONAPI = "application/vnd.api+json"
-	mediaTypeText    = "text/plain"
-	mediaTypeXml     = "application/xml"
-	mediaTypeCsv     = "text/csv"
+	mediaTypeJSON      = "application/json"
+	mediaTypeJSONAPI   = "application/vnd.api+json"
+	mediaTypeText      = "text/plain"
+	mediaTypeXml       = "application/xml"
+	mediaTypeCsv       = "text/csv"
+	mediaTypeForm      = "application/x-www-form-urlencoded"
+	mediaTypeMultipart = "multipart/form-data"
 )
 
+// interactionTypeHTTP is the type of the v4 interactions the proxy can serve, earlier specifications only have those
+const interactionTypeHTTP = "Synchronous/HTTP"
+
 type pathMatcher interface {
 	match(val string) bool
 }
@@ -42,18 +51,24 @@ func (m *regexPathMatcher) match(val string) bool {
 }
 
 type Interaction struct {
-	mu             sync.RWMutex
-	pathMatcher    pathMatcher
-	Method         string                           `json:"method"`
-	Alias          string                           `json:"alias"`
-	Description    string                           `json:"description"`
-	RequestCount   int                              `json:"request_count"`
-	RequestHistory []requestDocument                `json:"request_history,omitempty"`
-	LastRequest    requestDocument                  `json:"last_request"`
-	definition     map[string]interface{}           `json:"-"`
-	constraints    map[string]interactionConstraint `json:"-"`
-	modifiers      interactionModifiers             `json:"-"`
-	recordHistory  bool                             `json:"-"`
+	mu                 sync.RWMutex
+	pathMatcher        pathMatcher
+	routing            *requestRouting
+	Method             string                           `json:"method"`
+	Alias              string                           `json:"alias"`
+	Description        string                           `json:"description"`
+	Type               string                           `json:"type,omitempty"`
+	Pending            bool                             `json:"pending,omitempty"`
+	Comments           map[string]interface{}           `json:"comments,omitempty"`
+	RequestCount       int                              `json:"request_count"`
+	RequestHistory     []requestDocument                `json:"request_history,omitempty"`
+	LastRequest        requestDocument                  `json:"last_request"`
+	ResponseViolations []responseViolations             `json:"response_violations,omitempty"`
+	definition         map[string]interface{}           `json:"-"`
+	constraints        map[string]interactionConstraint `json:"-"`
+	modifiers          interactionModifiers             `json:"-"`
+	responseGenerators pactGenerators                   `json:"-"`
+	recordHistory      bool                             `json:"-"`
 }
 
 func LoadInteraction(data []byte, alias string) (*Interaction, error) {
@@ -68,11 +83,26 @@ func LoadInteraction(data []byte, alias string) (*Interaction, error) {
 		return nil, errors.New("unable to parse interaction definition, no Description defined")
 	}
 
+	interactionType, _ := definition["type"].(string)
+	if interactionType != "" && interactionType != interactionTypeHTTP {
+		return nil, errors.Errorf("unable to parse interaction definition, interactions of type %s are not supported", interactionType)
+	}
+
 	request, ok := definition["request"].(map[string]interface{})
 	if !ok {
 		return nil, errors.New("unable to parse interaction definition, no request defined")
 	}
 
+	// request generators are applied by the pact verifier, they are only validated and kept in the definition
+	if _, err := newPactGenerators(request["generators"]); err != nil {
+		return nil, errors.Wrap(err, "unable to parse interaction definition")
+	}
+	response, _ := definition["response"].(map[string]interface{})
+	responseGenerators, err := newPactGenerators(response["generators"])
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse interaction definition")
+	}
+
 	var matcher pathMatcher = &stringPathMatcher{val: request["path"].(string)}
 
 	matchingRules := getMatchingRules(request)
@@ -92,13 +122,31 @@ func LoadInteraction(data []byte, alias string) (*Interaction, error) {
 	}
 	propertiesWithMatchingRule := getBodyPropertiesWithMatchingRules(matchingRules)
 
+	rules, err := newPactRules(matchingRules)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse interaction definition")
+	}
+
+	routing, err := newRequestRouting(request, matchingRules)
+	if err != nil {
+		return nil, err
+	}
+
+	pending, _ := definition["pending"].(bool)
+	comments, _ := definition["comments"].(map[string]interface{})
+
 	interaction := &Interaction{
-		pathMatcher: matcher,
-		Method:      request["method"].(string),
-		Alias:       alias,
-		definition:  definition,
-		Description: description,
-		constraints: map[string]interactionConstraint{},
+		pathMatcher:        matcher,
+		routing:            routing,
+		Method:             request["method"].(string),
+		Alias:              alias,
+		definition:         definition,
+		Description:        description,
+		Type:               interactionType,
+		Pending:            pending,
+		Comments:           comments,
+		constraints:        map[string]interactionConstraint{},
+		responseGenerators: responseGenerators,
 	}
 
 	interaction.modifiers = interactionModifiers{
@@ -106,28 +154,81 @@ func LoadInteraction(data []byte, alias string) (*Interaction, error) {
 		modifiers:   map[string]*interactionModifier{},
 	}
 
+	interaction.addRoutingConstraintsFromPact(rules, routing)
+
 	requestBody, ok := request["body"]
 	if !ok {
 		return interaction, nil
 	}
 
-	mediaType, err := parseMediaType(request)
+	if interactionType != "" {
+		if requestBody, err = v4BodyContent(requestBody); err != nil {
+			return nil, errors.Wrap(err, "unable to parse request body")
+		}
+	}
+
+	mediaType, params, err := parseMediaTypeAndParams(request)
 	if err != nil {
 		return nil, errors.Wrap(err, "unable to parse media type")
 	}
 
+	if isXMLMediaType(mediaType) {
+		mediaType = mediaTypeXml
+	}
+
 	switch mediaType {
 	case mediaTypeJSON, mediaTypeJSONAPI:
-		interaction.addJSONConstraintsFromPact("$.body", propertiesWithMatchingRule, requestBody)
+		interaction.addJSONConstraintsFromPact("$.body", rules, requestBody, false)
+		return interaction, nil
+	case mediaTypeXml:
+		body, ok := requestBody.(string)
+		if !ok {
+			return nil, fmt.Errorf("media type is %s but body is not text", mediaType)
+		}
+		if parsed, err := parseXMLBody([]byte(body)); err == nil {
+			interaction.addXMLConstraintsFromPact("$."+xmlBody, xmlMatchingRules(rules), parsed)
+		} else {
+			interaction.addTextConstraintsFromPact(propertiesWithMatchingRule, body)
+		}
+		return interaction, nil
+	case mediaTypeCsv:
+		body, ok := requestBody.(string)
+		if !ok {
+			return nil, fmt.Errorf("media type is %s but body is not text", mediaType)
+		}
+		if parsed, err := parseCSVBody([]byte(body)); err == nil {
+			interaction.addCSVConstraintsFromPact(rules, body, parsed)
+		} else {
+			interaction.addTextConstraintsFromPact(propertiesWithMatchingRule, body)
+		}
 		return interaction, nil
-	case mediaTypeText, mediaTypeCsv, mediaTypeXml:
+	case mediaTypeText:
 		if body, ok := requestBody.(string); ok {
 			interaction.addTextConstraintsFromPact(propertiesWithMatchingRule, body)
 			return interaction, nil
 		}
 		return nil, fmt.Errorf("media type is %s but body is not text", mediaType)
+	case mediaTypeForm:
+		body, err := formBodyFromPact(requestBody)
+		if err != nil {
+			return nil, err
+		}
+		interaction.addJSONConstraintsFromPact("$.body", rules, body, false)
+		return interaction, nil
+	case mediaTypeMultipart:
+		body, ok := requestBody.(string)
+		if !ok {
+			return nil, fmt.Errorf("media type is %s but body is not text", mediaType)
+		}
+		parsed, err := parseMultipartBody([]byte(body), params["boundary"])
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse multipart body")
+		}
+		interaction.addMultipartConstraintsFromPact(rules, parsed)
+		return interaction, nil
 	}
-	return nil, fmt.Errorf("unsupported media type %s", mediaType)
+	log.Infof("Request body of media type %s is not constrained by default", mediaType)
+	return interaction, nil
 }
 
 // looks for a matching rule for key "$.path" in the supplied map
@@ -230,42 +331,116 @@ func getBodyPropertiesWithMatchingRules(matchingRules map[string]interface{}) ma
 }
 
 func parseMediaType(request map[string]interface{}) (string, error) {
-	headers, hasHeaders := request["headers"]
-	if !hasHeaders {
-		log.Info("Request has no headers defined - defaulting media type to text/plain")
-		return mediaTypeText, nil
+	mediaType, _, err := parseMediaTypeAndParams(request)
+	return mediaType, err
+}
+
+func parseMediaTypeAndParams(request map[string]interface{}) (string, map[string]string, error) {
+	var contentType interface{}
+	if headers, hasHeaders := request["headers"]; hasHeaders {
+		parsed, ok := headers.(map[string]interface{})
+		if !ok {
+			return "", nil, errors.New("incorrect format of request headers")
+		}
+		contentType = parsed["Content-Type"]
 	}
 
-	parsed, ok := headers.(map[string]interface{})
-	if !ok {
-		return "", errors.New("incorrect format of request headers")
+	// v4 pacts hold the values of headers in an array, and the content type of the body along with it
+	if values, isArray := contentType.([]interface{}); isArray && len(values) > 0 {
+		contentType = values[0]
+	}
+	if body, isV4 := request["body"].(map[string]interface{}); isV4 && contentType == nil {
+		contentType = body["contentType"]
 	}
 
-	contentType, ok := parsed["Content-Type"]
-	if !ok {
+	if contentType == nil {
 		log.Info("Request has no Content-Type header defined - defaulting media type to text/plain")
-		return mediaTypeText, nil
+		return mediaTypeText, nil, nil
 	}
 
 	contentTypeStr, ok := contentType.(string)
 	if !ok {
-		return "", errors.New("incorrect format of Content-Type header")
+		return "", nil, errors.New("incorrect format of Content-Type header")
 	}
 
-	mediaType, _, err := mime.ParseMediaType(contentTypeStr)
-	if err != nil {
-		return "", err
+	return mime.ParseMediaType(contentTypeStr)
+}
+
+// v4BodyContent reads the content of a v4 body, {"content": ..., "contentType": ..., "encoded": ...},
+// where the content is either held as is, or encoded as base64 or as a JSON string
+func v4BodyContent(body interface{}) (interface{}, error) {
+	v4Body, ok := body.(map[string]interface{})
+	if !ok {
+		return body, nil
+	}
+	content := v4Body["content"]
+	contentType, _ := v4Body["contentType"].(string)
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	switch encoded := strings.ToLower(fmt.Sprintf("%v", valueOr(v4Body["encoded"], false))); encoded {
+	case "false", "":
+		return content, nil
+	case "base64", "true":
+		s, ok := content.(string)
+		if !ok {
+			return nil, errors.New("base64 encoded body content is not a string")
+		}
+		decoded, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to decode base64 body content")
+		}
+		if mediaType == mediaTypeJSON || mediaType == mediaTypeJSONAPI {
+			var parsed interface{}
+			if err := json.Unmarshal(decoded, &parsed); err != nil {
+				return nil, errors.Wrap(err, "unable to parse JSON body content")
+			}
+			return parsed, nil
+		}
+		return string(decoded), nil
+	case "json":
+		s, ok := content.(string)
+		if !ok {
+			return content, nil
+		}
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(s), &parsed); err != nil {
+			return nil, errors.Wrap(err, "unable to parse JSON body content")
+		}
+		return parsed, nil
+	default:
+		return nil, errors.Errorf("unsupported body encoding %q", encoded)
 	}
+}
 
-	return mediaType, nil
+// formBodyFromPact reads the fields of a form body, which pact files hold either url-encoded or as an object
+func formBodyFromPact(requestBody interface{}) (map[string]interface{}, error) {
+	switch body := requestBody.(type) {
+	case string:
+		fields, _, err := parseFormBody([]byte(body))
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse form body")
+		}
+		return fields, nil
+	case map[string]interface{}:
+		return body, nil
+	}
+	return nil, fmt.Errorf("media type is %s but body is not a form", mediaTypeForm)
 }
 
-// This function adds constraints for all the fields in the JSON request body which do not
-// have a corresponding matching rule
-func (i *Interaction) addJSONConstraintsFromPact(path string, matchingRules map[string]bool, value interface{}) {
-	if _, hasRule := matchingRules[path]; hasRule {
-		return
+// This function adds constraints for all the fields in the JSON request body. Fields which do not have
+// a corresponding matching rule must equal the pact, those which do must satisfy the rule. A type rule
+// applies to the fields within the value it is attached to, and to every element of an array like eachLike.
+func (i *Interaction) addJSONConstraintsFromPact(path string, rules pactRules, value interface{}, typeMatched bool) {
+	if rule, hasRule := rules.find(path); hasRule {
+		i.addRuleConstraint(path, rule, value)
+		if !rule.cascades() {
+			return
+		}
+		typeMatched = true
+	} else if typeMatched {
+		i.addRuleConstraint(path, matchingRule{Matchers: []pactMatcher{{Match: matchType}}}, value)
 	}
+
 	switch val := value.(type) {
 	case map[string]interface{}:
 		// json_class is used to test for a Pact DSL-style matching rule within the body. The matchingRules passed
@@ -273,13 +448,32 @@ func (i *Interaction) addJSONConstraintsFromPact(path string, matchingRules map[
 		if _, exists := val["json_class"]; exists {
 			return
 		}
+		if rule, ok := rules.find(path); ok && rule.hasMatcher(matchValues) {
+			// only the values of the object are matched, against the first of them in the pact
+			keys := make([]string, 0, len(val))
+			for k := range val {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			if len(keys) > 0 {
+				i.addJSONConstraintsFromPact(path+".*", rules, val[keys[0]], true)
+			}
+			return
+		}
 		for k, v := range val {
-			i.addJSONConstraintsFromPact(path+"."+k, matchingRules, v)
+			i.addJSONConstraintsFromPact(path+"."+k, rules, v, typeMatched)
 		}
 	case []interface{}:
+		if typeMatched {
+			// every element is matched against the first element in the pact
+			if len(val) > 0 {
+				i.addJSONConstraintsFromPact(path+"[*]", rules, val[0], true)
+			}
+			return
+		}
 		// Create constraints for each element in the array. This allows matching rules to override them.
 		for j := range val {
-			i.addJSONConstraintsFromPact(fmt.Sprintf("%s[%d]", path, j), matchingRules, val[j])
+			i.addJSONConstraintsFromPact(fmt.Sprintf("%s[%d]", path, j), rules, val[j], false)
 		}
 		// Length constraint so that requests with additional elements at the end of the array will not match
 		i.AddConstraint(interactionConstraint{
@@ -288,6 +482,9 @@ func (i *Interaction) addJSONConstraintsFromPact(path string, matchingRules map[
 			Values: []interface{}{len(val)},
 		})
 	default:
+		if typeMatched {
+			return
+		}
 		i.AddConstraint(interactionConstraint{
 			Path:   path,
 			Format: "%v",
@@ -296,6 +493,31 @@ func (i *Interaction) addJSONConstraintsFromPact(path string, matchingRules map[
 	}
 }
 
+// This function adds constraints for the query parameters and headers which have matching rules,
+// the others are only used to route requests to the interaction
+func (i *Interaction) addRoutingConstraintsFromPact(rules pactRules, routing *requestRouting) {
+	for name, matcher := range routing.query {
+		path := ruleChildPath("$.query", name)
+		if rule, ok := rules.find(path); ok && len(matcher.values) > 0 {
+			i.addRuleConstraint(path, rule, matcher.values[0])
+		}
+	}
+	for name, matcher := range routing.headers {
+		path := ruleChildPath("$.headers", name)
+		if rule, ok := rules.find(path); ok && len(matcher.values) > 0 {
+			i.addRuleConstraint(path, rule, matcher.values[0])
+		}
+	}
+}
+
+func (i *Interaction) addRuleConstraint(path string, rule matchingRule, example interface{}) {
+	i.AddConstraint(interactionConstraint{
+		Path:   path,
+		Values: []interface{}{example},
+		Rule:   &rule,
+	})
+}
+
 // This function adds a constraint for the entire plain text request body if
 // it doesn't have a corresponding matching rule
 func (i *Interaction) addTextConstraintsFromPact(matchingRules map[string]bool, constraint string) {
@@ -312,12 +534,50 @@ func (i *Interaction) Match(path, method string) bool {
 	return method == i.Method && i.pathMatcher.match(path)
 }
 
+// MatchRouting reports whether the query parameters and headers of the request match those of the pact
+func (i *Interaction) MatchRouting(query url.Values, header http.Header) bool {
+	return i.routing.match(query, header)
+}
+
 func (i *Interaction) AddConstraint(constraint interactionConstraint) {
+	if constraint.Rule != nil {
+		rule := constraint.Rule.compiled()
+		constraint.Rule = &rule
+	}
 	i.mu.Lock()
 	defer i.mu.Unlock()
 	i.constraints[constraint.Key()] = constraint
 }
 
+func (i *Interaction) Constraints() []interactionConstraint {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	result := make([]interactionConstraint, 0, len(i.constraints))
+	for _, constraint := range i.constraints {
+		result = append(result, constraint)
+	}
+	sort.Slice(result, func(a, b int) bool {
+		return result[a].Key() < result[b].Key()
+	})
+	return result
+}
+
+// RemoveConstraints removes the constraints added to the interaction for the given path, or all of them
+// when path is empty. Constraints generated from the pact definition have no interaction set and are kept.
+func (i *Interaction) RemoveConstraints(path string) int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	removed := 0
+	for key, constraint := range i.constraints {
+		if constraint.Interaction == "" || (path != "" && constraint.Path != path) {
+			continue
+		}
+		delete(i.constraints, key)
+		removed++
+	}
+	return removed
+}
+
 func (i *Interaction) loadValuesFromSource(constraint interactionConstraint, interactions *Interactions) ([]interface{}, error) {
 	values := append([]interface{}(nil), constraint.Values...)
 	sourceInteraction, ok := interactions.Load(constraint.Source)
@@ -325,9 +585,7 @@ func (i *Interaction) loadValuesFromSource(constraint interactionConstraint, int
 		return nil, errors.Errorf("cannot find source interaction '%s' for constraint", constraint.Source)
 	}
 
-	i.mu.RLock()
-	sourceRequest := sourceInteraction.LastRequest
-	i.mu.RUnlock()
+	sourceRequest := sourceInteraction.lastRequest()
 	if sourceRequest == nil {
 		return nil, errors.Errorf("source interaction '%s' as no requests", constraint.Source)
 	}
@@ -339,34 +597,103 @@ func (i *Interaction) loadValuesFromSource(constraint interactionConstraint, int
 	return values, nil
 }
 
-func (i *Interaction) EvaluateConstraints(request requestDocument, interactions *Interactions) (bool, []string) {
-	result := true
-	violations := make([]string, 0)
+// responseConstraintPrefix is the path prefix of the constraints on the response an interaction gets from upstream,
+// e.g. "$.response.status", "$.response.headers.Location" or "$.response.body.id"
+const responseConstraintPrefix = "$.response."
+
+// responseViolations are the response constraints the response to an attempt of an interaction did not satisfy
+type responseViolations struct {
+	Attempt    int                   `json:"attempt"`
+	Violations []constraintViolation `json:"violations"`
+}
 
+// EvaluateConstraints checks the request against the constraints of the interaction, other than response constraints,
+// that apply in the states of the scenarios
+func (i *Interaction) EvaluateConstraints(request requestDocument, interactions *Interactions, states scenarioStates) (bool, []constraintViolation) {
+	return i.evaluateConstraints(request, interactions, states, func(constraint interactionConstraint) bool {
+		return !constraint.isResponse()
+	})
+}
+
+// EvaluateResponseConstraints checks the response constraints of the interaction that apply in the states of the
+// scenarios, the response is that of the request document. Constraints on the body of the response are not checked
+// when the body was not captured.
+func (i *Interaction) EvaluateResponseConstraints(request requestDocument, interactions *Interactions, states scenarioStates, bodyCaptured bool) (bool, []constraintViolation) {
+	return i.evaluateConstraints(request, interactions, states, func(constraint interactionConstraint) bool {
+		return constraint.isResponse() && (bodyCaptured || !constraint.isResponseBody())
+	})
+}
+
+// hasResponseBodyConstraints reports whether the interaction has constraints on the body of its response
+func (i *Interaction) hasResponseBodyConstraints() bool {
 	i.mu.RLock()
 	defer i.mu.RUnlock()
 	for _, constraint := range i.constraints {
+		if constraint.isResponseBody() {
+			return true
+		}
+	}
+	return false
+}
+
+func (i *Interaction) evaluateConstraints(request requestDocument, interactions *Interactions, states scenarioStates, applies func(interactionConstraint) bool) (bool, []constraintViolation) {
+	result := true
+	violations := make([]constraintViolation, 0)
+
+	// sources are resolved without the lock, as a constraint can be sourced from the interaction itself
+	var constraints []interactionConstraint
+	i.mu.RLock()
+	for _, constraint := range i.constraints {
+		if applies(constraint) && states.in(constraint.Scenario, constraint.State) {
+			constraints = append(constraints, constraint)
+		}
+	}
+	i.mu.RUnlock()
+	// violations are reported in the same order on every evaluation
+	sort.Slice(constraints, func(a, b int) bool {
+		if constraints[a].Path != constraints[b].Path {
+			return constraints[a].Path < constraints[b].Path
+		}
+		return constraints[a].Key() < constraints[b].Key()
+	})
+
+	for _, constraint := range constraints {
 		expected := constraint.Values
 		if constraint.Source != "" {
 			var err error
 			expected, err = i.loadValuesFromSource(constraint, interactions)
 			if err != nil {
-				violations = append(violations, err.Error())
+				violations = append(violations, constraintViolation{
+					Path:   constraint.Path,
+					Reason: err.Error(),
+				})
 				result = false
 				continue
 			}
 		}
 
 		actual, err := jsonpath.Get(request.encodeValues(constraint.Path), map[string]interface{}(request))
+		if err != nil && constraint.Rule != nil && constraint.hasWildcard() {
+			// rules for the elements of arrays and objects do not apply when there are none
+			continue
+		}
 		if err != nil {
-			violations = append(violations,
-				fmt.Sprintf("constraint path %q cannot be resolved within request: %q", constraint.Path, err))
+			violations = append(violations, constraintViolation{
+				Path:     constraint.Path,
+				Expected: constraint.expected(expected),
+				Reason:   fmt.Sprintf("constraint path %q cannot be resolved within request: %q", constraint.Path, err),
+			})
 			result = false
 			continue
 		}
 
 		if err := constraint.check(expected, actual); err != nil {
-			violations = append(violations, err.Error())
+			violations = append(violations, constraintViolation{
+				Path:     constraint.Path,
+				Expected: constraint.expected(expected),
+				Actual:   actual,
+				Reason:   err.Error(),
+			})
 			result = false
 		}
 	}
@@ -386,6 +713,70 @@ func (i *Interaction) StoreRequest(request requestDocument) int {
 	return i.RequestCount
 }
 
+// StoreResponse attaches the response returned to the consumer to the request it answered, which must be the
+// interaction's own copy, it is then available to constraints and the request history under "response"
+func (i *Interaction) StoreResponse(request requestDocument, response responseDocument) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	request["response"] = map[string]interface{}(response)
+}
+
+// StoreResponseViolations records the response constraints the response to the attempt did not satisfy
+func (i *Interaction) StoreResponseViolations(attempt int, violations []constraintViolation) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.ResponseViolations = append(i.ResponseViolations, responseViolations{Attempt: attempt, Violations: violations})
+}
+
+// ClearResponseViolations forgets the recorded violations of the response constraint with the path, or of every
+// response constraint when path is empty
+func (i *Interaction) ClearResponseViolations(path string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	kept := i.ResponseViolations[:0]
+	for _, r := range i.ResponseViolations {
+		var violations []constraintViolation
+		for _, v := range r.Violations {
+			if path != "" && v.Path != path {
+				violations = append(violations, v)
+			}
+		}
+		if len(violations) > 0 {
+			kept = append(kept, responseViolations{Attempt: r.Attempt, Violations: violations})
+		}
+	}
+	i.ResponseViolations = kept
+}
+
+// responseViolations returns the response constraints violated by the responses to the interaction so far
+func (i *Interaction) responseViolations() []constraintViolation {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	var result []constraintViolation
+	for _, r := range i.ResponseViolations {
+		result = append(result, r.Violations...)
+	}
+	return result
+}
+
+// lastRequest returns a copy of the last request, which is safe to read while responses are stored
+func (i *Interaction) lastRequest() requestDocument {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	if i.LastRequest == nil {
+		return nil
+	}
+	return i.LastRequest.copy()
+}
+
+// MarshalJSON encodes the interaction while holding its lock, as requests and responses may be stored meanwhile
+func (i *Interaction) MarshalJSON() ([]byte, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	type interaction Interaction
+	return json.Marshal((*interaction)(i))
+}
+
 func (i *Interaction) HasRequests(count int) bool {
 	return i.getRequestCount() >= count
 }
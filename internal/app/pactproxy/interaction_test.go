@@ -2,7 +2,10 @@ package pactproxy
 
 import (
 	"encoding/json"
+	"net/http"
+	"net/url"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -120,6 +123,93 @@ func TestLoadInteractionPlainTextConstraints(t *testing.T) {
 	}
 }
 
+func TestLoadInteractionFormConstraints(t *testing.T) {
+	tests := []struct {
+		name            string
+		contentType     string
+		body            string
+		matchingRules   string
+		wantConstraints []interactionConstraint
+	}{
+		{
+			name:        "url-encoded form",
+			contentType: "application/x-www-form-urlencoded",
+			body:        `"grant_type=client_credentials&scope=payments"`,
+			wantConstraints: []interactionConstraint{
+				{Path: "$.body.grant_type", Format: "%v", Values: []interface{}{"client_credentials"}},
+				{Path: "$.body.scope", Format: "%v", Values: []interface{}{"payments"}},
+			},
+		},
+		{
+			name:          "url-encoded form with matching rule",
+			contentType:   "application/x-www-form-urlencoded",
+			body:          `"grant_type=client_credentials&scope=payments"`,
+			matchingRules: `, "matchingRules": {"$.body.scope": {"regex": ".*"}}`,
+			wantConstraints: []interactionConstraint{
+				{Path: "$.body.grant_type", Format: "%v", Values: []interface{}{"client_credentials"}},
+			},
+		},
+		{
+			name:        "multipart form",
+			contentType: "multipart/form-data; boundary=XyZ",
+			body:        `"--XyZ\r\nContent-Disposition: form-data; name=\"type\"\r\n\r\nstatement\r\n--XyZ\r\nContent-Disposition: form-data; name=\"file\"; filename=\"statement.pdf\"\r\nContent-Type: application/pdf\r\n\r\n%PDF\r\n--XyZ--\r\n"`,
+			wantConstraints: []interactionConstraint{
+				{Path: "$.body.file.filename", Format: "%v", Values: []interface{}{"statement.pdf"}},
+				{Path: "$.body.type", Format: "%v", Values: []interface{}{"statement"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			definition := `{
+				"description": "A request to upload a form",
+				"request": {
+				  "method": "POST",
+				  "path": "/form",
+				  "headers": {"Content-Type": "` + tt.contentType + `"},
+				  "body": ` + tt.body + tt.matchingRules + `
+				}
+			}`
+
+			interaction, err := LoadInteraction([]byte(definition), "alias")
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantConstraints, exactConstraints(interaction))
+		})
+	}
+}
+
+func TestLoadInteractionXMLConstraints(t *testing.T) {
+	definition := `{
+		"description": "A request to initiate a payment",
+		"request": {
+		  "method": "POST",
+		  "path": "/payments",
+		  "headers": {"Content-Type": "application/xml"},
+		  "body": "<Document><MsgId>MSG-1</MsgId><Amt Ccy=\"EUR\">10.00</Amt></Document>",
+		  "matchingRules": {
+			"body": {"$.Document.Amt['#text']": {"matchers": [{"match": "decimal"}]}}
+		  }
+		}
+	}`
+
+	interaction, err := LoadInteraction([]byte(definition), "alias")
+	require.NoError(t, err)
+	assert.Equal(t, []interactionConstraint{
+		{Path: `$.body_xml.Document.Amt["@Ccy"]`, Format: "%v", Values: []interface{}{"EUR"}},
+		{Path: "$.body_xml.Document.MsgId", Format: "%v", Values: []interface{}{"MSG-1"}},
+	}, exactConstraints(interaction))
+
+	for body, matches := range map[string]bool{
+		`<Document><MsgId>MSG-1</MsgId><Amt Ccy="EUR">25.50</Amt></Document>`: true,
+		`<Document><MsgId>MSG-1</MsgId><Amt Ccy="EUR">ten</Amt></Document>`:   false,
+	} {
+		request, err := ParseXMLRequest([]byte(body), &url.URL{Path: "/payments"}, nil)
+		require.NoError(t, err)
+		ok, _ := interaction.EvaluateConstraints(request, &Interactions{}, nil)
+		assert.Equalf(t, matches, ok, "body %q", body)
+	}
+}
+
 func TestLoadInteractionJSONConstraints(t *testing.T) {
 	nestedArrMatchersNotPresent := `{
 		"description": "A request to create an address",
@@ -297,11 +387,7 @@ func TestLoadInteractionJSONConstraints(t *testing.T) {
 			interaction, err := LoadInteraction(tt.interaction, "alias")
 			require.NoError(t, err)
 
-			actual := make([]interactionConstraint, 0, len(interaction.constraints))
-			for _, constraint := range interaction.constraints {
-				actual = append(actual, constraint)
-			}
-			assert.ElementsMatch(t, tt.wantConstraints, actual)
+			assert.ElementsMatch(t, tt.wantConstraints, exactConstraints(interaction))
 		})
 	}
 }
@@ -430,7 +516,7 @@ func TestV3MatchingRulesLeadToCorrectConstraints(t *testing.T) {
 			require.Equalf(t, tt.wantErr, err != nil, "error %v", err)
 
 			var foundConstraint interactionConstraint
-			for _, constraint := range interaction.constraints {
+			for _, constraint := range exactConstraints(interaction) {
 				foundConstraint = constraint
 				break
 			}
@@ -440,6 +526,18 @@ func TestV3MatchingRulesLeadToCorrectConstraints(t *testing.T) {
 	}
 }
 
+// exactConstraints returns the constraints which require values to equal the pact, leaving out those
+// enforcing matching rules
+func exactConstraints(interaction *Interaction) []interactionConstraint {
+	var result []interactionConstraint
+	for _, constraint := range interaction.Constraints() {
+		if constraint.Rule == nil {
+			result = append(result, constraint)
+		}
+	}
+	return result
+}
+
 func Test_parseMediaType(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -665,3 +763,165 @@ func Test_loadValuesFromSource(t *testing.T) {
 		})
 	}
 }
+
+func TestConstraintSourcedFromItsOwnInteraction(t *testing.T) {
+	i := newInteraction("poll-payment")
+	i.AddConstraint(interactionConstraint{
+		Interaction: "poll-payment", Path: "$.body.id", Format: "%v", Source: "poll-payment", Values: []interface{}{"$.body.id"},
+	})
+	interactions := &Interactions{}
+	interactions.Store(i)
+	request := requestDocument{"query": map[string]interface{}{}, "body": map[string]interface{}{"id": "1"}}
+	i.StoreRequest(request)
+
+	stored, evaluated := make(chan struct{}), make(chan bool)
+	go func() {
+		defer close(stored)
+		for n := 0; n < 10000; n++ {
+			i.StoreRequest(request)
+		}
+	}()
+	go func() {
+		ok := true
+		for n := 0; n < 10000; n++ {
+			matched, _ := i.EvaluateConstraints(request, interactions, nil)
+			ok = ok && matched
+		}
+		evaluated <- ok
+	}()
+
+	timeout := time.After(5 * time.Second)
+	select {
+	case <-stored:
+	case <-timeout:
+		t.Fatal("storing requests is blocked by the evaluation of the constraints")
+	}
+	select {
+	case ok := <-evaluated:
+		assert.True(t, ok)
+	case <-timeout:
+		t.Fatal("the evaluation of the constraints is blocked by storing requests")
+	}
+}
+
+func TestConstraintViolationsAreSortedByPath(t *testing.T) {
+	i := newInteraction("create-payment")
+	for _, constraint := range []interactionConstraint{
+		{Interaction: "create-payment", Path: "$.body.reference", Format: "%v", Values: []interface{}{"ref"}},
+		{Interaction: "create-payment", Path: "$.body.amount", Operator: operatorGt, Values: []interface{}{10.0}},
+		{Interaction: "create-payment", Path: "$.body.amount", Format: "%v", Values: []interface{}{"20"}},
+		{Interaction: "create-payment", Path: "$.body.currency", Format: "%v", Values: []interface{}{"EUR"}},
+	} {
+		i.AddConstraint(constraint)
+	}
+	request := requestDocument{
+		"query": map[string]interface{}{},
+		"body":  map[string]interface{}{"amount": 5.0, "currency": "GBP", "reference": "other"},
+	}
+
+	for n := 0; n < 20; n++ {
+		ok, violations := i.EvaluateConstraints(request, &Interactions{}, nil)
+		require.False(t, ok)
+		var paths []string
+		for _, v := range violations {
+			paths = append(paths, v.Path)
+		}
+		require.Equal(t, []string{"$.body.amount", "$.body.amount", "$.body.currency", "$.body.reference"}, paths)
+		require.Equal(t, "20", violations[0].Expected)
+	}
+}
+
+func TestLoadInteractionV4(t *testing.T) {
+	definition := `{
+		"type": "Synchronous/HTTP",
+		"key": "3a1f",
+		"description": "A request to create a payment",
+		"pending": true,
+		"comments": {"text": ["created by the payments team"], "testname": "TestCreatePayment"},
+		"request": {
+		  "method": "POST",
+		  "path": "/payments",
+		  "headers": {"Content-Type": ["application/json"], "X-Request-Id": ["2f1c"]},
+		  "body": {
+			"content": {"reference": "ref-1", "items": [{"id": 1}]},
+			"contentType": "application/json",
+			"encoded": false
+		  },
+		  "matchingRules": {
+			"body": {"$.items": {"combine": "AND", "matchers": [{"match": "arrayContains", "variants": [{"index": 0, "rules": {}}]}]}},
+			"header": {"X-Request-Id": {"combine": "AND", "matchers": [{"match": "notEmpty"}]}}
+		  },
+		  "generators": {"body": {"$.reference": {"type": "RandomString", "size": 10}}}
+		},
+		"response": {
+		  "status": 201,
+		  "generators": {"header": {"location": {"type": "MockServerURL", "regex": ".*/payments/\\d+", "example": "http://localhost/payments/1"}}}
+		}
+	}`
+
+	interaction, err := LoadInteraction([]byte(definition), "alias")
+	require.NoError(t, err)
+
+	assert.Equal(t, "Synchronous/HTTP", interaction.Type)
+	assert.True(t, interaction.Pending)
+	assert.Equal(t, "TestCreatePayment", interaction.Comments["testname"])
+	assert.Equal(t, []interactionConstraint{
+		{Path: "$.body.reference", Format: "%v", Values: []interface{}{"ref-1"}},
+	}, exactConstraints(interaction))
+	assert.Len(t, interaction.Constraints(), 3)
+	assert.Equal(t, generatorMockServerURL, interaction.responseGenerators["$.headers.Location"].generatorType())
+	assert.True(t, interaction.MatchRouting(url.Values{}, http.Header{"Content-Type": {"application/json"}, "X-Request-Id": {"2f1c"}}))
+}
+
+func TestLoadInteractionV4Bodies(t *testing.T) {
+	tests := []struct {
+		name            string
+		request         string
+		wantErr         bool
+		wantConstraints []interactionConstraint
+	}{
+		{
+			name:            "base64 encoded JSON",
+			request:         `"body": {"content": "eyJpZCI6IDF9", "contentType": "application/json", "encoded": "base64"}`,
+			wantConstraints: []interactionConstraint{{Path: "$.body.id", Format: "%v", Values: []interface{}{float64(1)}}},
+		},
+		{
+			name:            "JSON string",
+			request:         `"body": {"content": "{\"id\": 1}", "contentType": "application/json", "encoded": "json"}`,
+			wantConstraints: []interactionConstraint{{Path: "$.body.id", Format: "%v", Values: []interface{}{float64(1)}}},
+		},
+		{
+			name:            "text with content type of the body",
+			request:         `"body": {"content": "hello", "contentType": "text/plain", "encoded": false}`,
+			wantConstraints: []interactionConstraint{{Path: "$.body", Format: "%v", Values: []interface{}{"hello"}}},
+		},
+		{
+			name:    "invalid base64",
+			request: `"body": {"content": "!", "contentType": "text/plain", "encoded": "base64"}`,
+			wantErr: true,
+		},
+		{
+			name:    "unknown generator",
+			request: `"body": {"content": "hello", "contentType": "text/plain"}, "generators": {"body": {"$": {"type": "Random"}}}`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			definition := `{"type": "Synchronous/HTTP", "description": "A request", "request": {"method": "POST", "path": "/", ` + tt.request + `}}`
+
+			interaction, err := LoadInteraction([]byte(definition), "alias")
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantConstraints, exactConstraints(interaction))
+		})
+	}
+}
+
+func TestLoadInteractionRejectsMessages(t *testing.T) {
+	_, err := LoadInteraction([]byte(`{"type": "Asynchronous/Messages", "description": "A payment event", "contents": {}}`), "alias")
+	assert.ErrorContains(t, err, "interactions of type Asynchronous/Messages are not supported")
+}
@@ -1,6 +1,9 @@
 package pactproxy
 
 import (
+	"net/http"
+	"net/url"
+	"sort"
 	"sync"
 )
 
@@ -30,9 +33,10 @@ func (i *Interactions) Load(key string) (*Interaction, bool) {
 	return result.(*Interaction), true
 }
 
-func (i *Interactions) FindAll(path, method string) ([]*Interaction, bool) {
+// FindAll returns the interactions matching the path, method, query parameters and headers of a request. Interactions
+// on the path that differ in their query parameters or headers are not candidates, as the mock server would not match them.
+func (i *Interactions) FindAll(path, method string, query url.Values, header http.Header) ([]*Interaction, bool) {
 	interactions := make(map[string]*Interaction)
-	var result []*Interaction
 	i.interactions.Range(func(_, v interface{}) bool {
 		if v.(*Interaction).Match(path, method) {
 			i := v.(*Interaction)
@@ -41,10 +45,12 @@ func (i *Interactions) FindAll(path, method string) ([]*Interaction, bool) {
 		return true
 	})
 
+	var result []*Interaction
 	for _, i := range interactions {
-		result = append(result, i)
+		if i.MatchRouting(query, header) {
+			result = append(result, i)
+		}
 	}
-
 	return result, len(result) > 0
 }
 
@@ -57,6 +63,24 @@ func (i *Interactions) All() []*Interaction {
 	return interactions
 }
 
+// Distinct returns every interaction once, even when it is stored under both its description and alias
+func (i *Interactions) Distinct() []*Interaction {
+	seen := make(map[*Interaction]bool)
+	var interactions []*Interaction
+	i.interactions.Range(func(_, v interface{}) bool {
+		interaction := v.(*Interaction)
+		if !seen[interaction] {
+			seen[interaction] = true
+			interactions = append(interactions, interaction)
+		}
+		return true
+	})
+	sort.Slice(interactions, func(a, b int) bool {
+		return interactions[a].Description < interactions[b].Description
+	})
+	return interactions
+}
+
 func (i *Interactions) AllHaveRequests() bool {
 	result := true
 	i.interactions.Range(func(_, v interface{}) bool {
@@ -0,0 +1,907 @@
+package pactproxy
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	matchType      = "type"
+	matchRegex     = "regex"
+	matchInteger   = "integer"
+	matchDecimal   = "decimal"
+	matchNumber    = "number"
+	matchDate      = "date"
+	matchTime      = "time"
+	matchTimestamp = "timestamp"
+	matchInclude   = "include"
+	matchNull      = "null"
+	matchValues    = "values"
+	matchEquality  = "equality"
+	matchBoolean   = "boolean"
+
+	// matchers introduced by the v4 specification
+	matchArrayContains = "arrayContains"
+	matchSemver        = "semver"
+	matchNotEmpty      = "notEmpty"
+	matchStatusCode    = "statusCode"
+	matchEachKey       = "eachKey"
+	matchEachValue     = "eachValue"
+
+	combineAnd = "AND"
+	combineOr  = "OR"
+)
+
+// pactMatcher is a single matcher of a pact matching rule
+type pactMatcher struct {
+	Match  string      `json:"match"`
+	Regex  string      `json:"regex,omitempty"`
+	Min    *int        `json:"min,omitempty"`
+	Max    *int        `json:"max,omitempty"`
+	Value  interface{} `json:"value,omitempty"`
+	Format string      `json:"format,omitempty"`
+
+	// Variants are the elements an array must contain for arrayContains
+	Variants []arrayVariant `json:"variants,omitempty"`
+	// Rules are the matchers applied to every key or value of an object for eachKey and eachValue
+	Rules []pactMatcher `json:"rules,omitempty"`
+	// Status is the class of status code, e.g. "success", or the list of status codes for statusCode
+	Status interface{} `json:"status,omitempty"`
+
+	// regex is the compiled Regex of a regex matcher, see compiled
+	regex *regexp.Regexp
+}
+
+// arrayVariant is an element an array must contain, the element of the pact at Index with rules
+// relative to the element, e.g. "$.id"
+type arrayVariant struct {
+	Index int       `json:"index"`
+	Rules pactRules `json:"rules,omitempty"`
+}
+
+// matchingRule is a pact matching rule, the matchers of which are combined with AND unless combine is OR
+type matchingRule struct {
+	Combine  string        `json:"combine,omitempty"`
+	Matchers []pactMatcher `json:"matchers"`
+}
+
+// parseMatchingRule reads a v2 rule, e.g. {"match": "type", "min": 1} or {"regex": "\\d+"},
+// or a v3 rule, e.g. {"combine": "OR", "matchers": [{"match": "integer"}, {"match": "null"}]}
+func parseMatchingRule(value interface{}) (matchingRule, error) {
+	rule, ok := value.(map[string]interface{})
+	if !ok {
+		return matchingRule{}, fmt.Errorf("matching rule must be an object, got %T", value)
+	}
+
+	matchers, isV3 := rule["matchers"].([]interface{})
+	if !isV3 {
+		matcher, err := parsePactMatcher(rule)
+		if err != nil {
+			return matchingRule{}, err
+		}
+		return matchingRule{Matchers: []pactMatcher{matcher}}, nil
+	}
+
+	result := matchingRule{Combine: strings.ToUpper(fmt.Sprintf("%v", valueOr(rule["combine"], combineAnd)))}
+	if result.Combine != combineAnd && result.Combine != combineOr {
+		return matchingRule{}, fmt.Errorf("unknown matching rule combine %q", result.Combine)
+	}
+	if result.Combine == combineAnd {
+		result.Combine = ""
+	}
+	for _, m := range matchers {
+		matcher, ok := m.(map[string]interface{})
+		if !ok {
+			return matchingRule{}, fmt.Errorf("matcher must be an object, got %T", m)
+		}
+		parsed, err := parsePactMatcher(matcher)
+		if err != nil {
+			return matchingRule{}, err
+		}
+		result.Matchers = append(result.Matchers, parsed)
+	}
+	return result, nil
+}
+
+func parsePactMatcher(m map[string]interface{}) (pactMatcher, error) {
+	matcher := pactMatcher{
+		Match: fmt.Sprintf("%v", valueOr(m["match"], "")),
+		Value: m["value"],
+	}
+
+	if regex, ok := m["regex"].(string); ok {
+		matcher.Regex = regex
+		if matcher.Match == "" {
+			matcher.Match = matchRegex
+		}
+	}
+	for _, key := range []string{"format", matchDate, matchTime, matchTimestamp} {
+		if format, ok := m[key].(string); ok {
+			matcher.Format = format
+			break
+		}
+	}
+
+	var err error
+	if matcher.Min, err = optionalInt(m["min"]); err != nil {
+		return pactMatcher{}, err
+	}
+	if matcher.Max, err = optionalInt(m["max"]); err != nil {
+		return pactMatcher{}, err
+	}
+	if matcher.Variants, err = parseArrayVariants(m["variants"]); err != nil {
+		return pactMatcher{}, err
+	}
+	if rules, ok := m["rules"].([]interface{}); ok {
+		for _, r := range rules {
+			rule, ok := r.(map[string]interface{})
+			if !ok {
+				return pactMatcher{}, fmt.Errorf("matcher must be an object, got %T", r)
+			}
+			parsed, err := parsePactMatcher(rule)
+			if err != nil {
+				return pactMatcher{}, err
+			}
+			matcher.Rules = append(matcher.Rules, parsed)
+		}
+	}
+	matcher.Status = m["status"]
+
+	if matcher.Match == "" && (matcher.Min != nil || matcher.Max != nil) {
+		matcher.Match = matchType
+	}
+	if matcher.Match == "" {
+		return pactMatcher{}, fmt.Errorf("matcher %v has no match type", m)
+	}
+	return matcher, nil
+}
+
+func parseArrayVariants(value interface{}) ([]arrayVariant, error) {
+	variants, ok := value.([]interface{})
+	if !ok {
+		return nil, nil
+	}
+	result := make([]arrayVariant, 0, len(variants))
+	for _, v := range variants {
+		variant, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("arrayContains variant must be an object, got %T", v)
+		}
+		index, err := toFloat(valueOr(variant["index"], 0.0))
+		if err != nil {
+			return nil, fmt.Errorf("invalid arrayContains variant index: %w", err)
+		}
+		parsed := arrayVariant{Index: int(index), Rules: pactRules{}}
+		rules, _ := variant["rules"].(map[string]interface{})
+		for path, r := range rules {
+			rule, err := parseMatchingRule(r)
+			if err != nil {
+				return nil, fmt.Errorf("invalid arrayContains rule for %s: %w", path, err)
+			}
+			parsed.Rules[path] = rule
+		}
+		result = append(result, parsed)
+	}
+	return result, nil
+}
+
+func optionalInt(value interface{}) (*int, error) {
+	if value == nil {
+		return nil, nil
+	}
+	f, err := toFloat(value)
+	if err != nil {
+		return nil, err
+	}
+	n := int(f)
+	return &n, nil
+}
+
+func valueOr(value, fallback interface{}) interface{} {
+	if value == nil {
+		return fallback
+	}
+	return value
+}
+
+// compiled returns a copy of the rule with the regexes of its matchers compiled, so that they are compiled once
+// rather than on every check. The rule itself is not changed, as it can be shared with the pact definition.
+func (r matchingRule) compiled() matchingRule {
+	matchers := make([]pactMatcher, len(r.Matchers))
+	for n, m := range r.Matchers {
+		matchers[n] = m.compiled()
+	}
+	r.Matchers = matchers
+	return r
+}
+
+func (m pactMatcher) compiled() pactMatcher {
+	if m.Match == matchRegex {
+		// an invalid regex is reported when the value is checked
+		m.regex, _ = regexp.Compile("^(?:" + m.Regex + ")$")
+	}
+	if len(m.Rules) > 0 {
+		m.Rules = matchingRule{Matchers: m.Rules}.compiled().Matchers
+	}
+	if len(m.Variants) > 0 {
+		variants := make([]arrayVariant, len(m.Variants))
+		for n, variant := range m.Variants {
+			variants[n] = arrayVariant{Index: variant.Index}
+			if variant.Rules != nil {
+				variants[n].Rules = make(pactRules, len(variant.Rules))
+				for path, rule := range variant.Rules {
+					variants[n].Rules[path] = rule.compiled()
+				}
+			}
+		}
+		m.Variants = variants
+	}
+	return m
+}
+
+func (r matchingRule) validate() error {
+	for _, m := range r.Matchers {
+		if err := m.validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m pactMatcher) validate() error {
+	if m.Match == matchRegex {
+		if _, err := regexp.Compile(m.Regex); err != nil {
+			return fmt.Errorf("invalid matching rule regex %q: %w", m.Regex, err)
+		}
+	}
+	if m.Match == matchStatusCode {
+		if _, err := statusCodeMatches(m.Status, 0); err != nil {
+			return err
+		}
+	}
+	for _, rule := range m.Rules {
+		if err := rule.validate(); err != nil {
+			return err
+		}
+	}
+	for _, variant := range m.Variants {
+		for _, rule := range variant.Rules {
+			if err := rule.validate(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+var knownMatchers = map[string]bool{
+	matchType: true, matchRegex: true, matchInteger: true, matchDecimal: true, matchNumber: true, matchDate: true,
+	matchTime: true, matchTimestamp: true, matchInclude: true, matchNull: true, matchValues: true,
+	matchEquality: true, matchBoolean: true, matchArrayContains: true, matchSemver: true, matchNotEmpty: true,
+	matchStatusCode: true, matchEachKey: true, matchEachValue: true,
+}
+
+// unknownMatchers returns the match types of the rule, and of the rules nested in it, that check does not know
+func (r matchingRule) unknownMatchers() []string {
+	var unknown []string
+	for _, m := range r.Matchers {
+		if !knownMatchers[m.Match] {
+			unknown = append(unknown, m.Match)
+		}
+		unknown = append(unknown, matchingRule{Matchers: m.Rules}.unknownMatchers()...)
+		for _, variant := range m.Variants {
+			for _, rule := range variant.Rules {
+				unknown = append(unknown, rule.unknownMatchers()...)
+			}
+		}
+	}
+	return unknown
+}
+
+// cascades reports whether the rule applies type matching to the children of the value it is attached to,
+// as a type, min or max rule does in pact
+func (r matchingRule) cascades() bool {
+	for _, m := range r.Matchers {
+		if m.Match == matchType || m.Match == matchValues {
+			return true
+		}
+	}
+	return false
+}
+
+func (r matchingRule) hasMatcher(match string) bool {
+	for _, m := range r.Matchers {
+		if m.Match == match {
+			return true
+		}
+	}
+	return false
+}
+
+func (r matchingRule) check(example, actual interface{}) error {
+	var errs []string
+	for _, m := range r.Matchers {
+		err := m.check(example, actual)
+		if err == nil && r.Combine == combineOr {
+			return nil
+		}
+		if err != nil {
+			if r.Combine != combineOr {
+				return err
+			}
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, " and "))
+	}
+	return nil
+}
+
+func (m pactMatcher) check(example, actual interface{}) error {
+	if err := m.checkLength(actual); err != nil {
+		return err
+	}
+
+	switch m.Match {
+	case matchType:
+		if jsonType(example) != jsonType(actual) {
+			return fmt.Errorf("expected a value of type %s but got %s", jsonType(example), jsonType(actual))
+		}
+	case matchRegex:
+		s, ok := scalarString(actual)
+		if !ok {
+			return fmt.Errorf("expected a value matching regex %q but got %s", m.Regex, jsonType(actual))
+		}
+		re := m.regex
+		if re == nil {
+			var err error
+			if re, err = regexp.Compile("^(?:" + m.Regex + ")$"); err != nil {
+				return fmt.Errorf("invalid regex %q: %w", m.Regex, err)
+			}
+		}
+		if !re.MatchString(s) {
+			return fmt.Errorf("expected %q to match regex %q", s, m.Regex)
+		}
+	case matchInteger, matchDecimal, matchNumber:
+		return m.checkNumber(example, actual)
+	case matchDate, matchTime, matchTimestamp:
+		s, ok := actual.(string)
+		if !ok {
+			return fmt.Errorf("expected a %s but got %s", m.Match, jsonType(actual))
+		}
+		if !matchesDateTime(m.Match, m.Format, s) {
+			return fmt.Errorf("expected %q to be a %s in format %q", s, m.Match, m.dateTimeFormat())
+		}
+	case matchInclude:
+		s, ok := scalarString(actual)
+		expected := fmt.Sprintf("%v", m.Value)
+		if !ok || !strings.Contains(s, expected) {
+			return fmt.Errorf("expected %v to include %q", actual, expected)
+		}
+	case matchNull:
+		if actual != nil {
+			return fmt.Errorf("expected null but got %v", actual)
+		}
+	case matchValues:
+		if jsonType(actual) != "object" && jsonType(actual) != "array" {
+			return fmt.Errorf("expected an object or array but got %s", jsonType(actual))
+		}
+	case matchEquality:
+		if !reflect.DeepEqual(example, actual) && fmt.Sprintf("%v", example) != fmt.Sprintf("%v", actual) {
+			return fmt.Errorf("expected %v but got %v", example, actual)
+		}
+	case matchBoolean:
+		if _, ok := actual.(bool); ok {
+			return nil
+		}
+		if s, ok := actual.(string); !ok || (s != "true" && s != "false") {
+			return fmt.Errorf("expected a boolean but got %v", actual)
+		}
+	case matchSemver:
+		s, ok := actual.(string)
+		if !ok || !semverRegex.MatchString(s) {
+			return fmt.Errorf("expected a semantic version but got %v", actual)
+		}
+	case matchNotEmpty:
+		if jsonType(example) != jsonType(actual) {
+			return fmt.Errorf("expected a value of type %s but got %s", jsonType(example), jsonType(actual))
+		}
+		if isEmpty(actual) {
+			return fmt.Errorf("expected a value that is not empty but got %v", actual)
+		}
+	case matchStatusCode:
+		status, err := toFloat(actual)
+		if err != nil {
+			return fmt.Errorf("expected a status code but got %v", actual)
+		}
+		if ok, err := statusCodeMatches(m.Status, int(status)); err != nil || !ok {
+			return fmt.Errorf("expected a status code matching %v but got %v", m.Status, actual)
+		}
+	case matchArrayContains:
+		return m.checkArrayContains(example, actual)
+	case matchEachKey, matchEachValue:
+		object, ok := actual.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("expected an object but got %s", jsonType(actual))
+		}
+		return m.checkEach(example, object)
+	}
+	// matchers that are not known are left to the mock server
+	return nil
+}
+
+// checkArrayContains checks that, for every variant, the array contains an element matching the element of the pact
+// at the index of the variant, with the rules of the variant, wherever the element is in the array
+func (m pactMatcher) checkArrayContains(example, actual interface{}) error {
+	elements, ok := actual.([]interface{})
+	if !ok {
+		return fmt.Errorf("expected an array but got %s", jsonType(actual))
+	}
+	examples, _ := example.([]interface{})
+
+	for _, variant := range m.Variants {
+		if variant.Index < 0 || variant.Index >= len(examples) {
+			return fmt.Errorf("arrayContains variant %d has no element in the pact", variant.Index)
+		}
+		found := false
+		for _, element := range elements {
+			if matchExample("$", variant.Rules, examples[variant.Index], element, false) == nil {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("expected the array to contain an element matching %v", examples[variant.Index])
+		}
+	}
+	return nil
+}
+
+// checkEach applies the rules of eachKey to every key, or those of eachValue to every value, of an object
+func (m pactMatcher) checkEach(example interface{}, object map[string]interface{}) error {
+	var exampleValue interface{}
+	if values, ok := example.(map[string]interface{}); ok {
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		if len(keys) > 0 {
+			exampleValue = values[keys[0]]
+		}
+	}
+
+	for key, value := range object {
+		for _, rule := range m.Rules {
+			var err error
+			if m.Match == matchEachKey {
+				err = rule.check(key, key)
+			} else {
+				err = rule.check(exampleValue, value)
+			}
+			if err != nil {
+				return fmt.Errorf("%s %q: %w", strings.TrimPrefix(m.Match, "each"), key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// matchExample matches a value with a value of the pact as the mock server does, values with a rule must satisfy
+// it and the others must equal the pact. It is used for elements of arrays, which cannot be given constraints.
+func matchExample(path string, rules pactRules, example, actual interface{}, typeMatched bool) error {
+	if rule, hasRule := rules.find(path); hasRule {
+		if err := rule.check(example, actual); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		if !rule.cascades() {
+			return nil
+		}
+		typeMatched = true
+	} else if typeMatched && jsonType(example) != jsonType(actual) {
+		return fmt.Errorf("%s: expected a value of type %s but got %s", path, jsonType(example), jsonType(actual))
+	}
+
+	switch e := example.(type) {
+	case map[string]interface{}:
+		object, ok := actual.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an object but got %s", path, jsonType(actual))
+		}
+		for k, v := range e {
+			value, ok := object[k]
+			if !ok {
+				return fmt.Errorf("%s.%s: value is missing", path, k)
+			}
+			if err := matchExample(path+"."+k, rules, v, value, typeMatched); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		array, ok := actual.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an array but got %s", path, jsonType(actual))
+		}
+		if typeMatched {
+			if len(e) == 0 {
+				return nil
+			}
+			for _, value := range array {
+				if err := matchExample(path+"[*]", rules, e[0], value, true); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if len(e) != len(array) {
+			return fmt.Errorf("%s: expected %d elements but got %d", path, len(e), len(array))
+		}
+		for n := range e {
+			if err := matchExample(fmt.Sprintf("%s[%d]", path, n), rules, e[n], array[n], false); err != nil {
+				return err
+			}
+		}
+	default:
+		if !typeMatched && fmt.Sprintf("%v", example) != fmt.Sprintf("%v", actual) {
+			return fmt.Errorf("%s: expected %v but got %v", path, example, actual)
+		}
+	}
+	return nil
+}
+
+var semverRegex = regexp.MustCompile(`^\d+\.\d+\.\d+(-[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?(\+[0-9A-Za-z-]+(\.[0-9A-Za-z-]+)*)?$`)
+
+var statusCodeClasses = map[string]func(int) bool{
+	"info":        func(s int) bool { return s >= 100 && s < 200 },
+	"success":     func(s int) bool { return s >= 200 && s < 300 },
+	"redirect":    func(s int) bool { return s >= 300 && s < 400 },
+	"clientError": func(s int) bool { return s >= 400 && s < 500 },
+	"serverError": func(s int) bool { return s >= 500 && s < 600 },
+	"nonError":    func(s int) bool { return s < 400 },
+	"error":       func(s int) bool { return s >= 400 },
+}
+
+// statusCodeMatches reports whether the status is of the class, e.g. "success", or in the list of status codes
+func statusCodeMatches(class interface{}, status int) (bool, error) {
+	switch c := class.(type) {
+	case string:
+		matches, ok := statusCodeClasses[c]
+		if !ok {
+			return false, fmt.Errorf("unknown status code class %q", c)
+		}
+		return matches(status), nil
+	case []interface{}:
+		for _, code := range c {
+			n, err := toFloat(code)
+			if err != nil {
+				return false, fmt.Errorf("invalid status code %v", code)
+			}
+			if int(n) == status {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, fmt.Errorf("statusCode matcher must have a status class or list of status codes, got %v", class)
+}
+
+func isEmpty(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case string:
+		return v == ""
+	case []interface{}:
+		return len(v) == 0
+	case map[string]interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+func (m pactMatcher) checkLength(actual interface{}) error {
+	if m.Min == nil && m.Max == nil {
+		return nil
+	}
+	array, ok := actual.([]interface{})
+	if !ok {
+		return nil
+	}
+	if m.Min != nil && len(array) < *m.Min {
+		return fmt.Errorf("expected at least %d elements but got %d", *m.Min, len(array))
+	}
+	if m.Max != nil && len(array) > *m.Max {
+		return fmt.Errorf("expected at most %d elements but got %d", *m.Max, len(array))
+	}
+	return nil
+}
+
+// checkNumber matches numbers, as well as numeric strings when the example is a string,
+// as the values of query parameters and headers are
+func (m pactMatcher) checkNumber(example, actual interface{}) error {
+	var value float64
+	switch v := actual.(type) {
+	case float64:
+		value = v
+	case string:
+		if _, exampleIsString := example.(string); !exampleIsString {
+			return fmt.Errorf("expected a %s but got %s", m.Match, jsonType(actual))
+		}
+		var err error
+		if value, err = strconv.ParseFloat(v, 64); err != nil {
+			return fmt.Errorf("expected a %s but got %q", m.Match, v)
+		}
+		if m.Match == matchDecimal && !strings.Contains(v, ".") {
+			return fmt.Errorf("expected a decimal but got %q", v)
+		}
+	default:
+		return fmt.Errorf("expected a %s but got %s", m.Match, jsonType(actual))
+	}
+
+	if m.Match == matchInteger && value != math.Trunc(value) {
+		return fmt.Errorf("expected an integer but got %v", actual)
+	}
+	return nil
+}
+
+func (m pactMatcher) dateTimeFormat() string {
+	if m.Format != "" {
+		return m.Format
+	}
+	return "ISO 8601"
+}
+
+var defaultDateTimeLayouts = map[string][]string{
+	matchDate:      {"2006-01-02"},
+	matchTime:      {"15:04:05", "15:04:05.999999999", "15:04:05Z07:00", "15:04:05.999999999Z07:00", "15:04"},
+	matchTimestamp: {time.RFC3339, time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02T15:04:05.999999999", "2006-01-02 15:04:05"},
+}
+
+func matchesDateTime(match, format, value string) bool {
+	layouts := defaultDateTimeLayouts[match]
+	if format != "" {
+		layouts = []string{javaDateTimeLayout(format)}
+	}
+	for _, layout := range layouts {
+		if _, err := time.Parse(layout, value); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+var javaDateTimeFields = map[string]string{
+	"yyyy": "2006", "yy": "06", "y": "2006",
+	"MMMM": "January", "MMM": "Jan", "MM": "01", "M": "1",
+	"dd": "02", "d": "2",
+	"EEEE": "Monday", "EEE": "Mon", "E": "Mon",
+	"HH": "15", "H": "15", "hh": "03", "h": "3",
+	"mm": "04", "m": "4",
+	"ss": "05", "s": "5",
+	"SSSSSSSSS": "000000000", "SSSSSS": "000000", "SSS": "000", "SS": "00", "S": "0",
+	"a":   "PM",
+	"XXX": "Z07:00", "XX": "Z0700", "X": "Z07",
+	"ZZZ": "-0700", "ZZ": "-0700", "Z": "-0700",
+	"z": "MST", "zzz": "MST",
+}
+
+// javaDateTimeLayout converts the Java SimpleDateFormat patterns used by pact into a Go time layout
+func javaDateTimeLayout(format string) string {
+	var layout strings.Builder
+	runes := []rune(format)
+	for n := 0; n < len(runes); {
+		r := runes[n]
+		switch {
+		case r == '\'':
+			end := n + 1
+			for end < len(runes) && runes[end] != '\'' {
+				end++
+			}
+			if end == n+1 {
+				layout.WriteRune('\'')
+			} else {
+				layout.WriteString(string(runes[n+1 : end]))
+			}
+			n = end + 1
+		case unicode.IsLetter(r):
+			end := n
+			for end < len(runes) && runes[end] == r {
+				end++
+			}
+			field := string(runes[n:end])
+			if goField, ok := javaDateTimeFields[field]; ok {
+				layout.WriteString(goField)
+			} else {
+				layout.WriteString(field)
+			}
+			n = end
+		default:
+			layout.WriteRune(r)
+			n++
+		}
+	}
+	return layout.String()
+}
+
+func jsonType(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64, float32, int, int64:
+		return "number"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func scalarString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64, bool:
+		return fmt.Sprintf("%v", v), true
+	}
+	return "", false
+}
+
+// pactRules holds the matching rules of a pact request by the path of the request document they apply to,
+// e.g. "$.body.items[*].id", "$.query.status" or "$.headers.Accept"
+type pactRules map[string]matchingRule
+
+func newPactRules(matchingRules map[string]interface{}) (pactRules, error) {
+	rules := pactRules{}
+	add := func(path string, value interface{}) error {
+		rule, err := parseMatchingRule(value)
+		if err != nil {
+			return fmt.Errorf("invalid matching rule for %s: %w", path, err)
+		}
+		if err := rule.validate(); err != nil {
+			return fmt.Errorf("invalid matching rule for %s: %w", path, err)
+		}
+		if unknown := rule.unknownMatchers(); len(unknown) > 0 {
+			log.Warnf("matching rule for %s uses matchers the proxy does not check, any value satisfies them: %s",
+				path, strings.Join(unknown, ", "))
+		}
+		rules[path] = rule
+		return nil
+	}
+
+	for key, value := range matchingRules {
+		switch {
+		case key == "$.body" || strings.HasPrefix(key, "$.body.") || strings.HasPrefix(key, "$.body["):
+			if err := add(key, value); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(key, "$.query."):
+			if err := add(ruleChildPath("$.query", strings.TrimPrefix(key, "$.query.")), value); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(key, "$.headers."):
+			name := strings.TrimPrefix(key, "$.headers.")
+			if err := add(ruleChildPath("$.headers", canonicalHeaderName(name)), value); err != nil {
+				return nil, err
+			}
+		case key == "body" || key == "query" || key == "header":
+			category, ok := value.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for name, rule := range category {
+				var path string
+				switch key {
+				case "body":
+					path = "$.body" + strings.TrimPrefix(name, "$")
+				case "query":
+					path = ruleChildPath("$.query", name)
+				case "header":
+					path = ruleChildPath("$.headers", canonicalHeaderName(name))
+				}
+				if err := add(path, rule); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return rules, nil
+}
+
+var ruleIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// ruleChildPath addresses a query parameter or header, quoting names that are not valid json path identifiers
+func ruleChildPath(path, name string) string {
+	if ruleIdentifier.MatchString(name) {
+		return path + "." + name
+	}
+	return path + `["` + name + `"]`
+}
+
+func canonicalHeaderName(name string) string {
+	return http.CanonicalHeaderKey(name)
+}
+
+var rulePathSegment = regexp.MustCompile(`\.([^.\[]+)|\[['"]([^'"]*)['"]\]|\[(\d+|\*)\]`)
+
+// pathSegments splits a path such as "$.body.items[0]['id']" into "items", "[0]" and "id"
+func pathSegments(path string) []string {
+	var segments []string
+	for _, m := range rulePathSegment.FindAllStringSubmatch(strings.TrimPrefix(path, "$"), -1) {
+		switch {
+		case m[1] != "":
+			segments = append(segments, m[1])
+		case m[3] != "":
+			segments = append(segments, "["+m[3]+"]")
+		default:
+			segments = append(segments, m[2])
+		}
+	}
+	return segments
+}
+
+// find returns the rule for a path, a rule with wildcards ("*" for any property and "[*]" for any index)
+// applies when there is no rule for the exact path, the one with the fewest wildcards first and then the first
+// by path
+func (r pactRules) find(path string) (matchingRule, bool) {
+	if rule, ok := r[path]; ok {
+		return rule, true
+	}
+
+	segments := pathSegments(path)
+	var found *matchingRule
+	var foundPath string
+	fewest := math.MaxInt32
+	for rulePath, rule := range r {
+		wildcards, ok := matchRulePath(pathSegments(rulePath), segments)
+		// rules with as many wildcards are told apart by their path, so the same rule is found on every lookup
+		if ok && (wildcards < fewest || (wildcards == fewest && rulePath < foundPath)) {
+			rule := rule
+			found, foundPath, fewest = &rule, rulePath, wildcards
+		}
+	}
+	if found == nil {
+		return matchingRule{}, false
+	}
+	return *found, true
+}
+
+func matchRulePath(rule, path []string) (int, bool) {
+	if len(rule) != len(path) {
+		return 0, false
+	}
+	wildcards := 0
+	for n := range rule {
+		switch {
+		case rule[n] == path[n]:
+		case rule[n] == "[*]" && strings.HasPrefix(path[n], "["):
+			wildcards++
+		case rule[n] == "*" && !strings.HasPrefix(path[n], "["):
+			wildcards++
+		default:
+			return 0, false
+		}
+	}
+	return wildcards, true
+}
+
+// has reports whether there is a rule for the path, used by the media types that only skip ruled values
+func (r pactRules) has(path string) bool {
+	_, ok := r.find(path)
+	return ok
+}
@@ -0,0 +1,178 @@
+package pactproxy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchingRuleCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    interface{}
+		example interface{}
+		actual  interface{}
+		matches bool
+	}{
+		{name: "type", rule: map[string]interface{}{"match": "type"}, example: "a", actual: "b", matches: true},
+		{name: "type differs", rule: map[string]interface{}{"match": "type"}, example: "a", actual: 1.0},
+		{name: "v2 min implies type", rule: map[string]interface{}{"min": 2.0}, example: []interface{}{"a"}, actual: []interface{}{"a"}},
+		{name: "max", rule: map[string]interface{}{"match": "type", "max": 1.0}, example: []interface{}{"a"}, actual: []interface{}{"a"}, matches: true},
+		{name: "v2 regex", rule: map[string]interface{}{"regex": `\d+`}, example: "1", actual: "42", matches: true},
+		{name: "regex must match whole value", rule: map[string]interface{}{"regex": `\d+`}, example: "1", actual: "42a"},
+		{name: "regex on number", rule: map[string]interface{}{"regex": `\d+`}, example: 1.0, actual: 42.0, matches: true},
+		{name: "integer", rule: map[string]interface{}{"match": "integer"}, example: 1.0, actual: 2.0, matches: true},
+		{name: "integer with fraction", rule: map[string]interface{}{"match": "integer"}, example: 1.0, actual: 2.5},
+		{name: "integer string when example is string", rule: map[string]interface{}{"match": "integer"}, example: "1", actual: "22", matches: true},
+		{name: "integer string when example is number", rule: map[string]interface{}{"match": "integer"}, example: 1.0, actual: "22"},
+		{name: "decimal", rule: map[string]interface{}{"match": "decimal"}, example: 1.5, actual: 2.25, matches: true},
+		{name: "number", rule: map[string]interface{}{"match": "number"}, example: 1.0, actual: "1"},
+		{name: "date with format", rule: map[string]interface{}{"match": "date", "date": "dd/MM/yyyy"}, example: "01/02/2020", actual: "31/12/2021", matches: true},
+		{name: "date in other format", rule: map[string]interface{}{"match": "date", "date": "dd/MM/yyyy"}, example: "01/02/2020", actual: "2021-12-31"},
+		{name: "v3 timestamp format", rule: map[string]interface{}{"match": "timestamp", "format": "yyyy-MM-dd'T'HH:mm:ss"}, example: "", actual: "2021-12-31T23:59:00", matches: true},
+		{name: "iso timestamp", rule: map[string]interface{}{"match": "timestamp"}, example: "", actual: "2021-12-31T23:59:00Z", matches: true},
+		{name: "time", rule: map[string]interface{}{"match": "time", "time": "HH:mm"}, example: "", actual: "25:00"},
+		{name: "include", rule: map[string]interface{}{"match": "include", "value": "pay"}, example: "payment", actual: "repayment", matches: true},
+		{name: "null", rule: map[string]interface{}{"match": "null"}, example: nil, actual: "a"},
+		{name: "values", rule: map[string]interface{}{"match": "values"}, example: map[string]interface{}{}, actual: map[string]interface{}{"a": 1.0}, matches: true},
+		{name: "equality", rule: map[string]interface{}{"match": "equality"}, example: "a", actual: "b"},
+		{name: "boolean", rule: map[string]interface{}{"match": "boolean"}, example: true, actual: "false", matches: true},
+		{name: "unknown matcher is left to the mock server", rule: map[string]interface{}{"match": "contentType"}, example: "", actual: 1.0, matches: true},
+		{name: "semver", rule: map[string]interface{}{"match": "semver"}, example: "1.0.0", actual: "2.10.3-rc.1+build.5", matches: true},
+		{name: "not semver", rule: map[string]interface{}{"match": "semver"}, example: "1.0.0", actual: "2.10"},
+		{name: "not empty", rule: map[string]interface{}{"match": "notEmpty"}, example: []interface{}{"a"}, actual: []interface{}{"b", "c"}, matches: true},
+		{name: "empty", rule: map[string]interface{}{"match": "notEmpty"}, example: "a", actual: ""},
+		{name: "status code class", rule: map[string]interface{}{"match": "statusCode", "status": "clientError"}, example: 400.0, actual: 404.0, matches: true},
+		{name: "status code not in list", rule: map[string]interface{}{"match": "statusCode", "status": []interface{}{200.0, 201.0}}, example: 200.0, actual: 204.0},
+		{
+			name: "array contains",
+			rule: map[string]interface{}{"match": "arrayContains", "variants": []interface{}{
+				map[string]interface{}{"index": 0.0, "rules": map[string]interface{}{"$.id": map[string]interface{}{"matchers": []interface{}{map[string]interface{}{"match": "integer"}}}}},
+				map[string]interface{}{"index": 1.0},
+			}},
+			example: []interface{}{map[string]interface{}{"id": 1.0, "type": "a"}, map[string]interface{}{"type": "b"}},
+			actual:  []interface{}{map[string]interface{}{"type": "c"}, map[string]interface{}{"type": "b"}, map[string]interface{}{"id": 7.0, "type": "a"}},
+			matches: true,
+		},
+		{
+			name: "array does not contain",
+			rule: map[string]interface{}{"match": "arrayContains", "variants": []interface{}{
+				map[string]interface{}{"index": 0.0},
+			}},
+			example: []interface{}{map[string]interface{}{"type": "a"}},
+			actual:  []interface{}{map[string]interface{}{"type": "b"}},
+		},
+		{
+			name:    "each key",
+			rule:    map[string]interface{}{"match": "eachKey", "rules": []interface{}{map[string]interface{}{"match": "regex", "regex": "[a-z]+"}}},
+			example: map[string]interface{}{"a": 1.0}, actual: map[string]interface{}{"b": 1.0, "C": 2.0},
+		},
+		{
+			name:    "each value",
+			rule:    map[string]interface{}{"match": "eachValue", "rules": []interface{}{map[string]interface{}{"match": "type"}}},
+			example: map[string]interface{}{"a": 1.0}, actual: map[string]interface{}{"b": 2.0, "c": 3.0}, matches: true,
+		},
+		{
+			name:    "matchers combined with AND",
+			rule:    map[string]interface{}{"matchers": []interface{}{map[string]interface{}{"match": "type"}, map[string]interface{}{"match": "regex", "regex": "[a-z]+"}}},
+			example: "a", actual: "ab1",
+		},
+		{
+			name:    "matchers combined with OR",
+			rule:    map[string]interface{}{"combine": "OR", "matchers": []interface{}{map[string]interface{}{"match": "integer"}, map[string]interface{}{"match": "null"}}},
+			example: 1.0, actual: nil, matches: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := parseMatchingRule(tt.rule)
+			require.NoError(t, err)
+			err = rule.check(tt.example, tt.actual)
+			assert.Equalf(t, tt.matches, err == nil, "error %v", err)
+		})
+	}
+}
+
+func TestNewPactRules(t *testing.T) {
+	rules, err := newPactRules(map[string]interface{}{
+		"$.body.items[*].id": map[string]interface{}{"match": "type"},
+		"$.query.page":       map[string]interface{}{"regex": `\d+`},
+		"$.headers.x-tenant": map[string]interface{}{"match": "type"},
+		"body": map[string]interface{}{
+			"$.items[*].*": map[string]interface{}{"matchers": []interface{}{map[string]interface{}{"match": "type"}}},
+		},
+		"header": map[string]interface{}{
+			"content-type": map[string]interface{}{"matchers": []interface{}{map[string]interface{}{"match": "regex", "regex": "application/.*"}}},
+		},
+	})
+	require.NoError(t, err)
+
+	for _, path := range []string{"$.body.items[*].id", "$.query.page", `$.headers["X-Tenant"]`, `$.headers["Content-Type"]`} {
+		assert.Contains(t, rules, path)
+	}
+
+	rule, ok := rules.find("$.body.items[3].id")
+	require.True(t, ok)
+	assert.Equal(t, matchType, rule.Matchers[0].Match)
+	assert.True(t, rules.has("$.body.items[3].name"))
+	assert.False(t, rules.has("$.body.items.name"))
+
+	_, err = newPactRules(map[string]interface{}{"$.body.id": map[string]interface{}{"regex": "("}})
+	assert.Error(t, err)
+}
+
+func TestPactRulesFindBreaksTiesByPath(t *testing.T) {
+	rules := pactRules{
+		"$.body.items[*]": matchingRule{Matchers: []pactMatcher{{Match: matchType}}},
+		"$.body.*[0]":     matchingRule{Matchers: []pactMatcher{{Match: matchInteger}}},
+	}
+	for n := 0; n < 20; n++ {
+		rule, ok := rules.find("$.body.items[0]")
+		require.True(t, ok)
+		assert.Equal(t, matchInteger, rule.Matchers[0].Match)
+	}
+}
+
+func TestMatchingRuleRegexesAreCompiledWithTheConstraint(t *testing.T) {
+	rule := matchingRule{Matchers: []pactMatcher{
+		{Match: matchRegex, Regex: `\d+`},
+		{Match: matchEachValue, Rules: []pactMatcher{{Match: matchRegex, Regex: "[a-z]+"}}},
+	}}
+	i := newInteraction("get-payment")
+	i.AddConstraint(interactionConstraint{Interaction: "get-payment", Path: "$.body.id", Values: []interface{}{"1"}, Rule: &rule})
+
+	compiled := i.Constraints()[0].Rule
+	require.NotNil(t, compiled.Matchers[0].regex)
+	require.NotNil(t, compiled.Matchers[1].Rules[0].regex)
+	assert.Nil(t, rule.Matchers[0].regex, "the rule of the pact definition is not changed")
+	assert.Nil(t, rule.Matchers[1].Rules[0].regex)
+	regex := matchingRule{Matchers: compiled.Matchers[:1]}
+	assert.NoError(t, regex.check("1", "42"))
+	assert.Error(t, regex.check("1", "4a"))
+}
+
+func TestMatchingRuleUnknownMatchers(t *testing.T) {
+	rule, err := parseMatchingRule(map[string]interface{}{"matchers": []interface{}{
+		map[string]interface{}{"match": "type"},
+		map[string]interface{}{"match": "contentType", "value": "image/png"},
+		map[string]interface{}{"match": "eachValue", "rules": []interface{}{map[string]interface{}{"match": "fancy"}}},
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"contentType", "fancy"}, rule.unknownMatchers())
+}
+
+func TestJavaDateTimeLayout(t *testing.T) {
+	tests := map[string]string{
+		"yyyy-MM-dd":                   "2006-01-02",
+		"dd/MM/yy HH:mm":               "02/01/06 15:04",
+		"yyyy-MM-dd'T'HH:mm:ss.SSSXXX": "2006-01-02T15:04:05.000Z07:00",
+		"EEE, d MMM yyyy HH:mm:ss Z":   "Mon, 2 Jan 2006 15:04:05 -0700",
+		"h:mm a":                       "3:04 PM",
+		"'at' HH''":                    "at 15'",
+	}
+	for format, layout := range tests {
+		assert.Equal(t, layout, javaDateTimeLayout(format), format)
+	}
+}
@@ -3,9 +3,12 @@ package pactproxy
 import (
 	"encoding/base64"
 	"fmt"
+	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/tidwall/sjson"
 )
 
@@ -14,6 +17,47 @@ type interactionModifier struct {
 	Path        string      `json:"path"`
 	Value       interface{} `json:"value"`
 	Attempt     *int        `json:"attempt"`
+	Attempts    string      `json:"attempts,omitempty"`
+	Scenario    string      `json:"scenario,omitempty"`
+	State       string      `json:"state,omitempty"`
+}
+
+func (im *interactionModifier) validate() error {
+	if (im.Scenario == "") != (im.State == "") {
+		return fmt.Errorf("scenario and state must be used together")
+	}
+	if im.Attempts != "" {
+		if im.Attempt != nil {
+			return fmt.Errorf("attempt and attempts cannot be used together")
+		}
+		if _, err := parseAttempts(im.Attempts); err != nil {
+			return err
+		}
+	}
+
+	switch im.Path {
+	case "$.delay":
+		if _, err := parseDelay(im.Value); err != nil {
+			return err
+		}
+	case "$.fault":
+		return validateFault(im.Value)
+	}
+
+	if strings.HasPrefix(im.Path, "$.request.") {
+		switch {
+		case im.Path == "$.request.path":
+		case strings.HasPrefix(im.Path, "$.request.headers."), strings.HasPrefix(im.Path, "$.request.query."),
+			strings.HasPrefix(im.Path, "$.request.body."):
+		default:
+			return fmt.Errorf("unknown request modifier path %q", im.Path)
+		}
+		return validateTemplate(im.Value)
+	}
+	if strings.HasPrefix(im.Path, "$.body.") || strings.HasPrefix(im.Path, "$.headers.") {
+		return validateTemplate(im.Value)
+	}
+	return nil
 }
 
 type interactionModifiers struct {
@@ -25,12 +69,51 @@ func (im *interactionModifier) Key() string {
 	var key string
 	if im.Attempt != nil {
 		key = strings.Join([]string{im.Interaction, im.Path, strconv.Itoa(*im.Attempt)}, "_")
+	} else if im.Attempts != "" {
+		key = strings.Join([]string{im.Interaction, im.Path, im.Attempts}, "_")
 	} else {
 		key = strings.Join([]string{im.Interaction, im.Path}, "_")
 	}
+	if im.Scenario != "" {
+		key = strings.Join([]string{key, im.Scenario, im.State}, "_")
+	}
 	return key
 }
 
+// appliesTo reports whether the modifier applies to the request with the given count, matched when the
+// scenarios were in the given states
+func (im *interactionModifier) appliesTo(requestCount int, states scenarioStates) bool {
+	if !states.in(im.Scenario, im.State) {
+		return false
+	}
+	switch {
+	case im.Attempt != nil:
+		return *im.Attempt == requestCount
+	case im.Attempts != "":
+		attempts, err := parseAttempts(im.Attempts)
+		return err == nil && attempts.matches(requestCount)
+	default:
+		return true
+	}
+}
+
+// precedence ranks modifiers that apply to the same request, a single attempt is more specific
+// than a pattern of attempts which is more specific than every attempt, and a modifier for a scenario state
+// is more specific than one for any state
+func (im *interactionModifier) precedence() int {
+	precedence := 0
+	switch {
+	case im.Attempt != nil:
+		precedence = 2
+	case im.Attempts != "":
+		precedence = 1
+	}
+	if im.Scenario != "" {
+		precedence += 3
+	}
+	return precedence
+}
+
 func (ims *interactionModifiers) AddModifier(modifier *interactionModifier) {
 	ims.interaction.mu.Lock()
 	defer ims.interaction.mu.Unlock()
@@ -47,40 +130,197 @@ func (ims *interactionModifiers) Modifiers() []*interactionModifier {
 	return result
 }
 
-func (ims *interactionModifiers) modifyBody(b []byte, requestCount int) ([]byte, error) {
+// RemoveModifiers removes the modifiers for the given path, or all of them when path is empty
+func (ims *interactionModifiers) RemoveModifiers(path string) int {
+	ims.interaction.mu.Lock()
+	defer ims.interaction.mu.Unlock()
+	removed := 0
+	for key, modifier := range ims.modifiers {
+		if path != "" && modifier.Path != path {
+			continue
+		}
+		delete(ims.modifiers, key)
+		removed++
+	}
+	return removed
+}
+
+// applicable returns the modifiers matching the path prefix that apply to the request count and scenario states,
+// ordered so that the more specific modifiers come last and take precedence
+func (ims *interactionModifiers) applicable(prefix string, requestCount int, states scenarioStates) []*interactionModifier {
+	var result []*interactionModifier
 	for _, m := range ims.Modifiers() {
-		if m.Path == "$.bytes.body" {
-			if v, ok := m.Value.(string); ok && m.Attempt == nil || *m.Attempt == requestCount {
-				var err error
-				if b, err = base64.StdEncoding.DecodeString(v); err != nil {
-					return nil, err
-				}
-			}
+		if strings.HasPrefix(m.Path, prefix) && m.appliesTo(requestCount, states) {
+			result = append(result, m)
 		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].precedence() != result[j].precedence() {
+			return result[i].precedence() < result[j].precedence()
+		}
+		return result[i].Key() < result[j].Key()
+	})
+	return result
+}
 
-		if strings.HasPrefix(m.Path, "$.body.") {
-			if m.Attempt == nil || *m.Attempt == requestCount {
-				var err error
-				b, err = sjson.SetBytes(b, m.Path[7:], m.Value)
-				if err != nil {
-					return nil, err
-				}
+// modifyBody applies the body modifiers, rendering their values as templates of the matched request.
+// Elements of XML bodies are rewritten in place, other bodies are modified as JSON. A modifier that cannot be
+// applied is logged and skipped, like header modifiers, as the headers of the response have already been written.
+func (ims *interactionModifiers) modifyBody(b []byte, mediaType string, request requestDocument, requestCount int, states scenarioStates) []byte {
+	template := responseTemplate{request: request, requestCount: requestCount}
+	for _, m := range ims.applicable("$.bytes.body", requestCount, states) {
+		if v, ok := m.Value.(string); ok && m.Path == "$.bytes.body" {
+			decoded, err := base64.StdEncoding.DecodeString(v)
+			if err != nil {
+				log.WithError(err).Warnf("unable to decode body modifier for %q", m.Path)
+				continue
 			}
+			b = decoded
 		}
 	}
-	return b, nil
+
+	for _, m := range ims.applicable("$.body.", requestCount, states) {
+		value, err := template.render(m.Value)
+		if err != nil {
+			log.WithError(err).Warnf("unable to render body modifier for %q", m.Path)
+			continue
+		}
+		var modified []byte
+		if isXMLMediaType(mediaType) {
+			modified, err = modifyXML(b, m.Path[7:], value)
+		} else {
+			modified, err = sjson.SetBytes(b, m.Path[7:], value)
+		}
+		if err != nil {
+			log.WithError(err).Warnf("unable to apply body modifier for %q", m.Path)
+			continue
+		}
+		b = modified
+	}
+	return b
 }
 
-func (ims *interactionModifiers) modifyStatusCode(requestCount int) (bool, int) {
-	for _, m := range ims.Modifiers() {
-		if m.Path == "$.status" {
-			if m.Attempt == nil || *m.Attempt == requestCount {
-				code, err := strconv.Atoi(fmt.Sprintf("%v", m.Value))
-				if err == nil {
-					return true, code
+// modifyHeaders sets, overrides or removes (when the value is null) the response headers addressed by
+// "$.headers.<Name>" modifiers. Modifiers for specific attempts are applied last so they take precedence.
+func (ims *interactionModifiers) modifyHeaders(header http.Header, request requestDocument, requestCount int, states scenarioStates) {
+	template := responseTemplate{request: request, requestCount: requestCount}
+	for _, m := range ims.applicable("$.headers.", requestCount, states) {
+		name := m.Path[len("$.headers."):]
+		value, err := template.render(m.Value)
+		if err != nil {
+			log.WithError(err).Warnf("unable to render header modifier for %q", name)
+			continue
+		}
+		setHeader(header, name, value)
+	}
+}
+
+// setHeader sets the header to the value, every element of an array is a value of the header and null removes it
+func setHeader(header http.Header, name string, value interface{}) {
+	switch v := value.(type) {
+	case nil:
+		header.Del(name)
+	case []interface{}:
+		header.Del(name)
+		for _, value := range v {
+			header.Add(name, fmt.Sprintf("%v", value))
+		}
+	default:
+		header.Set(name, fmt.Sprintf("%v", v))
+	}
+}
+
+// modifyRequest applies the "$.request." modifiers to a request before it is forwarded to a provider: headers
+// ("$.request.headers.<Name>"), query parameters ("$.request.query.<name>"), the path ("$.request.path") and the body
+// ("$.request.body.<path>"). Values are templates of the request as it was received, the modified body is returned.
+func (ims *interactionModifiers) modifyRequest(req *http.Request, body []byte, mediaType string, request requestDocument, requestCount int, states scenarioStates) ([]byte, error) {
+	template := responseTemplate{request: request, requestCount: requestCount}
+	query, queryModified := req.URL.Query(), false
+	for _, m := range ims.applicable("$.request.", requestCount, states) {
+		value, err := template.render(m.Value)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case strings.HasPrefix(m.Path, "$.request.headers."):
+			setHeader(req.Header, strings.TrimPrefix(m.Path, "$.request.headers."), value)
+		case strings.HasPrefix(m.Path, "$.request.query."):
+			name := strings.TrimPrefix(m.Path, "$.request.query.")
+			queryModified = true
+			switch v := value.(type) {
+			case nil:
+				query.Del(name)
+			case []interface{}:
+				query.Del(name)
+				for _, value := range v {
+					query.Add(name, fmt.Sprintf("%v", value))
 				}
+			default:
+				query.Set(name, fmt.Sprintf("%v", v))
+			}
+		case m.Path == "$.request.path":
+			req.URL.Path, req.URL.RawPath = fmt.Sprintf("%v", value), ""
+		case strings.HasPrefix(m.Path, "$.request.body."):
+			path := strings.TrimPrefix(m.Path, "$.request.body.")
+			if isXMLMediaType(mediaType) {
+				body, err = modifyXML(body, path, value)
+			} else {
+				body, err = sjson.SetBytes(body, path, value)
 			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if queryModified {
+		req.URL.RawQuery = query.Encode()
+	}
+	return body, nil
+}
+
+// forAttempt returns the most specific modifier for path that applies to the attempt
+func (ims *interactionModifiers) forAttempt(path string, requestCount int, states scenarioStates) (*interactionModifier, bool) {
+	var result *interactionModifier
+	for _, m := range ims.applicable(path, requestCount, states) {
+		if m.Path == path {
+			result = m
 		}
 	}
-	return false, 0
+	return result, result != nil
+}
+
+func (ims *interactionModifiers) responseDelay(requestCount int, states scenarioStates) (responseDelay, bool) {
+	m, ok := ims.forAttempt("$.delay", requestCount, states)
+	if !ok {
+		return responseDelay{}, false
+	}
+
+	delay, err := parseDelay(m.Value)
+	if err != nil {
+		return responseDelay{}, false
+	}
+	return delay, true
+}
+
+func (ims *interactionModifiers) fault(requestCount int, states scenarioStates) (string, bool) {
+	m, ok := ims.forAttempt("$.fault", requestCount, states)
+	if !ok {
+		return "", false
+	}
+
+	fault, ok := m.Value.(string)
+	return fault, ok
+}
+
+func (ims *interactionModifiers) modifyStatusCode(requestCount int, states scenarioStates) (bool, int) {
+	m, ok := ims.forAttempt("$.status", requestCount, states)
+	if !ok {
+		return false, 0
+	}
+
+	code, err := strconv.Atoi(fmt.Sprintf("%v", m.Value))
+	if err != nil {
+		return false, 0
+	}
+	return true, code
 }
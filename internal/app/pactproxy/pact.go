@@ -0,0 +1,114 @@
+package pactproxy
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// pactFile is a whole pact, as the Rust mock server is given one for every mock server it starts
+type pactFile struct {
+	Consumer     map[string]interface{} `json:"consumer"`
+	Provider     map[string]interface{} `json:"provider"`
+	Interactions []json.RawMessage      `json:"interactions"`
+	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// LoadPact loads every interaction of a pact, the interactions of a v4 pact which are not HTTP interactions are skipped
+func LoadPact(data []byte) ([]*Interaction, error) {
+	var pact pactFile
+	if err := json.Unmarshal(data, &pact); err != nil {
+		return nil, errors.Wrap(err, "unable to parse pact")
+	}
+	if pact.Interactions == nil {
+		return nil, errors.New("unable to parse pact, no interactions defined")
+	}
+
+	interactions := make([]*Interaction, 0, len(pact.Interactions))
+	for n, data := range pact.Interactions {
+		var header struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(data, &header); err != nil {
+			return nil, errors.Wrapf(err, "unable to parse interaction %d of pact", n)
+		}
+		if header.Type != "" && header.Type != interactionTypeHTTP {
+			continue
+		}
+
+		interaction, err := LoadInteraction(data, "")
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to load interaction %d of pact", n)
+		}
+		interactions = append(interactions, interaction)
+	}
+	return interactions, nil
+}
+
+// Versions of the pact specification pacts are written with
+const (
+	pactSpecificationV2 = "2.0.0"
+	pactSpecificationV3 = "3.0.0"
+	pactSpecificationV4 = "4.0"
+)
+
+// newPactFile creates the pact of the interactions, sorted by description. The specification version is the lowest
+// that can describe every interaction: v4 interactions have a type, v3 adds generators and categorised matching rules.
+func newPactFile(consumer, provider map[string]interface{}, interactions []*Interaction) (*pactFile, error) {
+	if consumer == nil {
+		consumer = map[string]interface{}{"name": "consumer"}
+	}
+	if provider == nil {
+		provider = map[string]interface{}{"name": "provider"}
+	}
+
+	sorted := append([]*Interaction(nil), interactions...)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return sorted[a].Description < sorted[b].Description
+	})
+
+	version := pactSpecificationV2
+	pact := &pactFile{
+		Consumer:     consumer,
+		Provider:     provider,
+		Interactions: make([]json.RawMessage, 0, len(sorted)),
+	}
+	for _, interaction := range sorted {
+		data, err := json.Marshal(interaction.definition)
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to encode interaction '%s'", interaction.Description)
+		}
+		pact.Interactions = append(pact.Interactions, data)
+
+		switch {
+		case interaction.Type != "":
+			version = pactSpecificationV4
+		case version == pactSpecificationV2 && usesPactV3(interaction.definition):
+			version = pactSpecificationV3
+		}
+	}
+	pact.Metadata = map[string]interface{}{
+		"pactSpecification": map[string]interface{}{"version": version},
+	}
+	return pact, nil
+}
+
+// usesPactV3 reports whether the request or response of an interaction has generators or matching rules
+// grouped by category, which v2 pacts cannot describe
+func usesPactV3(definition map[string]interface{}) bool {
+	for _, part := range []string{"request", "response"} {
+		message, _ := definition[part].(map[string]interface{})
+		if _, ok := message["generators"]; ok {
+			return true
+		}
+		rules, _ := message["matchingRules"].(map[string]interface{})
+		for category := range rules {
+			switch category {
+			case "body", "query", "header", "path", "status":
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,175 @@
+package pactproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/form3tech-oss/pact-proxy/internal/app/httpresponse"
+)
+
+// pactFiles are the pact files interactions are loaded from when the proxy starts, and on demand
+type pactFiles struct {
+	files []string
+	dir   string
+	// mu serialises loads, so that a reload does not interleave with the preload retrying in the background
+	mu     sync.Mutex
+	loaded atomic.Bool
+}
+
+func (p *pactFiles) configured() bool {
+	return len(p.files) > 0 || p.dir != ""
+}
+
+// paths returns the configured files followed by the JSON files of the configured directory
+func (p *pactFiles) paths() ([]string, error) {
+	paths := append([]string(nil), p.files...)
+	if p.dir != "" {
+		matches, err := filepath.Glob(filepath.Join(p.dir, "*.json"))
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to list pact files in %s", p.dir)
+		}
+		sort.Strings(matches)
+		paths = append(paths, matches...)
+	}
+	return paths, nil
+}
+
+// preloadPactFiles loads the pact files in the background, retrying until the mock server is ready to register them.
+// The proxy is not ready until they are loaded.
+func (a *api) preloadPactFiles() {
+	go func() {
+		failed := retryFor(func(time.Duration) bool {
+			if err := a.loadPactFiles(); err != nil {
+				log.WithError(err).Warn("unable to preload pact files")
+				return false
+			}
+			return true
+		}, a.delay, a.duration)
+		if failed {
+			log.Error("pact files were not preloaded, the proxy will not be ready until they are reloaded")
+		}
+	}()
+}
+
+// loadPactFiles registers the interactions of the pact files with the proxy and the mock server, if there is one,
+// in place of any interactions registered before. The proxy is not ready while they are loaded, nor after they
+// failed to load, as only some of them may be registered.
+func (a *api) loadPactFiles() error {
+	a.pactFiles.mu.Lock()
+	defer a.pactFiles.mu.Unlock()
+	a.pactFiles.loaded.Store(false)
+
+	paths, err := a.pactFiles.paths()
+	if err != nil {
+		return err
+	}
+	if a.backend == BackendRust && len(paths) > 1 {
+		return fmt.Errorf("the rust backend serves a single pact, but %d pact files are configured", len(paths))
+	}
+
+	pacts := make(map[string][]*Interaction, len(paths))
+	data := make(map[string][]byte, len(paths))
+	for _, path := range paths {
+		if data[path], err = os.ReadFile(path); err != nil {
+			return errors.Wrap(err, "unable to read pact file")
+		}
+		if pacts[path], err = LoadPact(data[path]); err != nil {
+			return errors.Wrapf(err, "unable to load pact file %s", path)
+		}
+	}
+
+	if a.backend == BackendRust {
+		if id := a.mockServer.currentID(); id != "" {
+			a.forwardAdminRequest(http.MethodDelete, "/mockserver/"+id, nil)
+			a.mockServer.reset(id)
+		}
+		for _, path := range paths {
+			req, _ := http.NewRequest(http.MethodPost, "/", bytes.NewReader(data[path]))
+			req.Header.Set("Content-Type", "application/json")
+			rec, err := a.registerPact(req, pacts[path])
+			if err != nil {
+				return errors.Wrapf(err, "unable to register pact file %s", path)
+			}
+			if rec.Code >= http.StatusMultipleChoices {
+				return fmt.Errorf("unable to register pact file %s with the mock server: %d %s", path, rec.Code, rec.Body.String())
+			}
+			log.Infof("loaded %d interactions from %s", len(pacts[path]), path)
+		}
+		a.pactFiles.loaded.Store(true)
+		return nil
+	}
+
+	if a.backend == BackendStandalone || a.backend == BackendProvider {
+		a.interactions.Clear()
+		a.unmatched.Clear()
+		for _, path := range paths {
+			for _, interaction := range pacts[path] {
+				interaction.recordHistory = a.recordHistory
+				a.interactions.Store(interaction)
+			}
+			log.Infof("loaded %d interactions from %s", len(pacts[path]), path)
+		}
+		a.pactFiles.loaded.Store(true)
+		return nil
+	}
+
+	if rec := a.forwardAdminRequest(http.MethodDelete, "/interactions", nil); rec.Code >= http.StatusMultipleChoices {
+		return fmt.Errorf("unable to delete the interactions of the mock server: %d %s", rec.Code, rec.Body.String())
+	}
+	a.interactions.Clear()
+	a.unmatched.Clear()
+	for _, path := range paths {
+		for _, interaction := range pacts[path] {
+			definition, err := json.Marshal(interaction.definition)
+			if err != nil {
+				return errors.Wrap(err, "unable to encode interaction")
+			}
+			if rec := a.forwardAdminRequest(http.MethodPost, "/interactions", definition); rec.Code >= http.StatusMultipleChoices {
+				return fmt.Errorf("unable to register interaction '%s' with the mock server: %d %s",
+					interaction.Description, rec.Code, rec.Body.String())
+			}
+			interaction.recordHistory = a.recordHistory
+			a.interactions.Store(interaction)
+		}
+		log.Infof("loaded %d interactions from %s", len(pacts[path]), path)
+	}
+	a.pactFiles.loaded.Store(true)
+	return nil
+}
+
+// forwardAdminRequest sends a request of the proxy itself to the admin API of the mock server
+func (a *api) forwardAdminRequest(method, path string, body []byte) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, bytes.NewReader(body))
+	req.Header.Set("X-Pact-Mock-Service", "true")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rec := httptest.NewRecorder()
+	a.proxy.ServeHTTP(rec, req)
+	return rec
+}
+
+func (a *api) pactFilesReloadHandler(c echo.Context) error {
+	if !a.pactFiles.configured() {
+		return c.JSON(http.StatusBadRequest, httpresponse.Error("no pact files are configured, set PACT_FILES or PACT_DIR"))
+	}
+
+	log.Info("reloading pact files")
+	if err := a.loadPactFiles(); err != nil {
+		return c.JSON(http.StatusInternalServerError, httpresponse.Errorf("unable to reload pact files. %s", err.Error()))
+	}
+	return c.NoContent(http.StatusOK)
+}
@@ -0,0 +1,115 @@
+package pactproxy
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/form3tech-oss/pact-proxy/internal/app/httpresponse"
+)
+
+// interactionHeader names the interaction a request of the pact verifier is for, by description or alias.
+// It is removed before the request is forwarded to the provider.
+const interactionHeader = "X-Pact-Interaction"
+
+// providerInteraction returns the interaction a request of the pact verifier is for, named by the
+// interactionHeader or else the only interaction routed to by the request. Pact verifiers do not name the
+// interaction of their requests, so the header has to be added to them, e.g. as a custom header of the verifier.
+func (a *api) providerInteraction(req *http.Request) (*Interaction, bool) {
+	if name := req.Header.Get(interactionHeader); name != "" {
+		interaction, ok := a.interactions.Load(name)
+		if !ok {
+			log.Warnf("unable to find interaction '%s' named by the %s header", name, interactionHeader)
+		}
+		return interaction, ok
+	}
+
+	interactions, ok := a.interactions.FindAll(req.URL.Path, req.Method, req.URL.Query(), req.Header)
+	if !ok {
+		return nil, false
+	}
+	if len(interactions) > 1 {
+		// interactions sharing a path and method can differ by body or provider state only, picking one would apply
+		// the modifiers of another interaction
+		log.Warnf("%d interactions are routed to by %s %s, it is forwarded unmodified as it has no %s header",
+			len(interactions), req.Method, req.URL.Path, interactionHeader)
+		return nil, false
+	}
+	return interactions[0], true
+}
+
+// providerHandler forwards a request of the pact verifier to the provider, applying the request modifiers of its
+// interaction before and the response modifiers after. Requests for no interaction, such as those setting up
+// provider states, are forwarded as they are.
+func (a *api) providerHandler(c echo.Context) error {
+	req := c.Request()
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, httpresponse.Errorf("unable to read request. %s", err.Error()))
+	}
+
+	interaction, ok := a.providerInteraction(req)
+	req.Header.Del(interactionHeader)
+	if !ok {
+		log.Infof("forwarding %s %s to the provider", req.Method, req.URL.Path)
+		req.Body = io.NopCloser(bytes.NewBuffer(data))
+		a.proxy.ServeHTTP(c.Response(), req)
+		return nil
+	}
+
+	mediaType, params, err := parseMediaTypeHeader(req.Header)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, httpresponse.Errorf("failed to parse Content-Type header. %s", err.Error()))
+	}
+	request, err := requestParserFor(mediaType)(data, req.URL, params)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, httpresponse.Errorf("unable to read requestDocument data. %s", err.Error()))
+	}
+	request["headers"], request["header_values"] = parseHeaders(req.Header)
+
+	states := a.scenarios.states()
+	attemptCount := interaction.StoreRequest(request)
+	a.scenarios.matched(interaction)
+	a.notify.Notify()
+
+	body, err := interaction.modifiers.modifyRequest(req, data, mediaType, request, attemptCount, states)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, httpresponse.Errorf("unable to modify request. %s", err.Error()))
+	}
+	req.Body = io.NopCloser(bytes.NewBuffer(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Del("Content-Length")
+
+	log.Infof("forwarding interaction '%s' to the provider as %s %s", interaction.Description, req.Method, req.URL.Path)
+
+	// the response of the provider is buffered, as the modifiers need to know the length of its body
+	rec := httptest.NewRecorder()
+	a.proxy.ServeHTTP(rec, req)
+	w := &ResponseModificationWriter{
+		ctx: req.Context(),
+		res: c.Response(),
+		matchedInteractions: []matchedInteraction{{
+			interaction:  interaction,
+			request:      request,
+			attemptCount: attemptCount,
+			states:       states,
+		}},
+		interactions: a.interactions,
+	}
+	for name, values := range rec.Header() {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(rec.Body.Len()))
+	w.WriteHeader(rec.Code)
+	if rec.Body.Len() > 0 {
+		if _, err := w.Write(rec.Body.Bytes()); err != nil {
+			log.WithError(err).Warn("unable to write response")
+		}
+	}
+	return nil
+}
@@ -2,11 +2,13 @@ package pactproxy
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"mime"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -22,6 +24,16 @@ const (
 	defaultDuration = 15 * time.Second
 )
 
+// Backends the proxy can sit in front of, which differ in how interactions are registered and verified
+const (
+	BackendRuby = "ruby" // pact-mock_service, the Ruby standalone mock service
+	BackendRust = "rust" // pact_mock_server, the Rust mock server used by pact-go v2
+
+	BackendStandalone = "standalone" // no mock server, responses are generated from the interactions by the proxy
+	BackendRecord     = "record"     // a real provider, whose exchanges with the consumer are recorded into a pact
+	BackendProvider   = "provider"   // a real provider, verified by a pact verifier through the proxy
+)
+
 type Config struct {
 	ServerAddress               url.URL       `env:"SERVER_ADDRESS"`      // Address to listen on
 	Proxies                     []url.URL     `env:"PROXIES,delimiter=;"` // List of URL to serve pact-proxy on, e.g. http://localhost:8080;http://localhost:8081
@@ -32,22 +44,64 @@ type Config struct {
 	TLSCAFile                   string        `env:"TLS_CA_FILE"`
 	TLSCertFile                 string        `env:"TLS_CERT_FILE"`
 	TLSKeyFile                  string        `env:"TLS_KEY_FILE"`
+	Backend                     string        `env:"BACKEND"`                // Mock server behind the proxy, ruby (default), rust, standalone, record or provider
+	PactFiles                   []string      `env:"PACT_FILES,delimiter=;"` // Pact files to load interactions from at startup
+	PactDir                     string        `env:"PACT_DIR"`               // Directory of pact files to load interactions from at startup
+	PactOutputDir               string        `env:"PACT_OUTPUT_DIR"`        // Directory the pacts of the standalone and record backends are written to
 	Target                      url.URL       // Do not load Target from env, we set this for each value from Proxies
 }
 
-var supportedMediaTypes = map[string]func([]byte, *url.URL) (requestDocument, error){
-	mediaTypeJSON:    ParseJSONRequest,
-	mediaTypeJSONAPI: ParseJSONRequest,
-	mediaTypeText:    ParsePlainTextRequest,
-	mediaTypeCsv:     ParsePlainTextRequest,
-	mediaTypeXml:     ParsePlainTextRequest,
+// Validate checks the configuration for values the proxy cannot be set up with
+func (c *Config) Validate() error {
+	switch c.Backend {
+	case "", BackendRuby, BackendRust, BackendStandalone, BackendProvider:
+		return nil
+	case BackendRecord:
+		if len(c.PactFiles) > 0 || c.PactDir != "" {
+			return fmt.Errorf("pact files cannot be loaded by the %s backend, it records the pact", BackendRecord)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown backend %q", c.Backend)
+}
+
+// requestParser parses the body of a request into a requestDocument, params are those of the Content-Type header.
+// Bodies of media types without a parser are handled by ParseBinaryRequest.
+type requestParser func(data []byte, url *url.URL, params map[string]string) (requestDocument, error)
+
+var supportedMediaTypes = map[string]requestParser{
+	mediaTypeJSON:      ParseJSONRequest,
+	mediaTypeJSONAPI:   ParseJSONRequest,
+	mediaTypeText:      ParsePlainTextRequest,
+	mediaTypeCsv:       ParseCSVRequest,
+	mediaTypeXml:       ParseXMLRequest,
+	mediaTypeTextXml:   ParseXMLRequest,
+	mediaTypeForm:      ParseFormRequest,
+	mediaTypeMultipart: ParseMultipartRequest,
+}
+
+func requestParserFor(mediaType string) requestParser {
+	if parseRequest, ok := supportedMediaTypes[mediaType]; ok {
+		return parseRequest
+	}
+	if isXMLMediaType(mediaType) {
+		return ParseXMLRequest
+	}
+	return ParseBinaryRequest
 }
 
 type api struct {
 	target        *url.URL
 	proxy         *httputil.ReverseProxy
+	mockServer    mockServerTarget
+	backend       string
+	pactFiles     *pactFiles
 	interactions  *Interactions
 	notify        *notify
+	unmatched     *unmatchedRequests
+	recordings    *recordedExchanges
+	scenarios     *scenarios
+	pactOutputDir string
 	delay         time.Duration
 	duration      time.Duration
 	recordHistory bool
@@ -67,10 +121,16 @@ func SetupRoutes(e *echo.Echo, config *Config) {
 		proxy:                       httputil.NewSingleHostReverseProxy(&config.Target),
 		interactions:                &Interactions{},
 		notify:                      NewNotify(),
+		unmatched:                   &unmatchedRequests{},
 		delay:                       config.WaitDelay,
 		duration:                    config.WaitDuration,
 		recordHistory:               config.RecordHistory,
 		forwardUnrecognisedRequests: config.ForwardUnrecognisedRequests,
+		backend:                     config.Backend,
+		pactFiles:                   &pactFiles{files: config.PactFiles, dir: config.PactDir},
+		recordings:                  &recordedExchanges{},
+		scenarios:                   newScenarios(),
+		pactOutputDir:               config.PactOutputDir,
 	}
 	if a.delay == 0 {
 		a.delay = defaultDelay
@@ -79,23 +139,71 @@ func SetupRoutes(e *echo.Echo, config *Config) {
 		a.duration = defaultDuration
 	}
 
-	e.GET("/ready", a.readinessHandler)
+	if a.pactFiles.configured() {
+		a.preloadPactFiles()
+	}
 
-	e.Any("/interactions/verification", a.proxyPassHandler)
-	e.Any("/pact", a.proxyPassHandler)
+	e.GET("/ready", a.readinessHandler)
+	e.POST("/pacts/reload", a.pactFilesReloadHandler)
 
 	e.POST("/interactions/constraints", a.interactionsConstraintsHandler)
+	e.GET("/interactions/constraints", a.interactionsConstraintsGetHandler)
+	e.DELETE("/interactions/constraints", a.interactionsConstraintsDeleteHandler)
 	e.POST("/interactions/modifiers", a.interactionsModifiersHandler)
+	e.GET("/interactions/modifiers", a.interactionsModifiersGetHandler)
+	e.DELETE("/interactions/modifiers", a.interactionsModifiersDeleteHandler)
+
+	switch config.Backend {
+	case BackendRust:
+		// a pact is posted for every mock server, which is then managed under /mockserver/:id
+		e.POST("/", a.pactPostHandler)
+		e.DELETE("/mockserver/:id", a.mockServerDeleteHandler)
+		e.Any("/mockserver/*", a.proxyPassHandler)
+	case BackendStandalone:
+		// the proxy is the mock server, so it verifies the interactions and writes the pact itself
+		e.GET("/interactions/verification", a.verificationHandler)
+		e.GET("/pact", a.pactWriteHandler)
+		e.POST("/pact", a.pactWriteHandler)
+		e.DELETE("/session", a.interactionsClearHandler)
+		e.POST("/interactions", a.interactionsStoreHandler)
+		e.DELETE("/interactions", a.interactionsClearHandler)
+	case BackendProvider:
+		// requests of the pact verifier are modified for the provider, interactions are only stored to key the modifiers
+		e.POST("/interactions", a.interactionsStoreHandler)
+		e.DELETE("/interactions", a.interactionsClearHandler)
+		e.DELETE("/session", a.interactionsClearHandler)
+	case BackendRecord:
+		// the pact is recorded from the exchanges with the provider, rather than registered
+		e.GET("/pact", a.recordedPactHandler)
+		e.POST("/pact", a.recordedPactHandler)
+		e.DELETE("/session", a.recordingsDeleteHandler)
+	default:
+		e.Any("/interactions/verification", a.proxyPassHandler)
+		e.Any("/pact", a.proxyPassHandler)
+		e.DELETE("/session", a.sessionHandler)
+		e.POST("/interactions", a.interactionsPostHandler)
+		e.DELETE("/interactions", a.interactionsDeleteHandler)
+	}
 
-	e.DELETE("/session", a.sessionHandler)
-
-	e.POST("/interactions", a.interactionsPostHandler)
-	e.DELETE("/interactions", a.interactionsDeleteHandler)
+	e.POST("/scenarios", a.scenariosPostHandler)
+	e.GET("/scenarios", a.scenariosGetHandler)
+	e.DELETE("/scenarios", a.scenariosDeleteHandler)
+	e.PUT("/scenarios/:name/state", a.scenarioStatePutHandler)
 
 	e.GET("/interactions/details/:alias", a.interactionsGetHandler)
+	e.GET("/interactions/responses/verification", a.responsesVerificationHandler)
+	e.GET("/interactions/unmatched", a.unmatchedGetHandler)
+	e.DELETE("/interactions/unmatched", a.unmatchedDeleteHandler)
 	e.GET("/interactions/wait", a.interactionsWaitHandler)
 
-	e.Any("/*", a.indexHandler)
+	switch config.Backend {
+	case BackendRecord:
+		e.Any("/*", a.recordHandler)
+	case BackendProvider:
+		e.Any("/*", a.providerHandler)
+	default:
+		e.Any("/*", a.indexHandler)
+	}
 }
 
 func (a *api) proxyPassHandler(c echo.Context) error {
@@ -103,6 +211,9 @@ func (a *api) proxyPassHandler(c echo.Context) error {
 }
 
 func (a *api) readinessHandler(c echo.Context) error {
+	if a.pactFiles != nil && a.pactFiles.configured() && !a.pactFiles.loaded.Load() {
+		return c.JSON(http.StatusServiceUnavailable, httpresponse.Error("pact files have not been loaded"))
+	}
 	return c.NoContent(http.StatusOK)
 }
 
@@ -113,6 +224,10 @@ func (a *api) interactionsConstraintsHandler(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, httpresponse.Errorf("unable to load constraint. %s", err.Error()))
 	}
 
+	if err := constraint.validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, httpresponse.Errorf("invalid constraint. %s", err.Error()))
+	}
+
 	interaction, ok := a.interactions.Load(constraint.Interaction)
 	if !ok {
 		return c.JSON(http.StatusBadRequest, httpresponse.Errorf("unable to find interaction. %s", constraint.Interaction))
@@ -131,6 +246,10 @@ func (a *api) interactionsModifiersHandler(c echo.Context) error {
 		return c.JSON(http.StatusBadRequest, httpresponse.Errorf("unable to load modifier. %s", err.Error()))
 	}
 
+	if err := modifier.validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, httpresponse.Errorf("invalid modifier. %s", err.Error()))
+	}
+
 	interaction, ok := a.interactions.Load(modifier.Interaction)
 	if !ok {
 		return c.JSON(http.StatusBadRequest, httpresponse.Errorf("unable to find interaction for modifier. %s", modifier.Interaction))
@@ -142,8 +261,94 @@ func (a *api) interactionsModifiersHandler(c echo.Context) error {
 	return c.NoContent(http.StatusOK)
 }
 
+// filteredInteractions returns the interaction named by the "interaction" query parameter,
+// or all interactions when it is not set
+func (a *api) filteredInteractions(c echo.Context) ([]*Interaction, bool) {
+	name := c.QueryParam("interaction")
+	if name == "" {
+		return a.interactions.Distinct(), true
+	}
+
+	interaction, ok := a.interactions.Load(name)
+	if !ok {
+		return nil, false
+	}
+	return []*Interaction{interaction}, true
+}
+
+func (a *api) interactionsConstraintsGetHandler(c echo.Context) error {
+	interactions, ok := a.filteredInteractions(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, httpresponse.Errorf("interaction %q not found", c.QueryParam("interaction")))
+	}
+
+	path := c.QueryParam("path")
+	constraints := make([]interactionConstraint, 0)
+	for _, interaction := range interactions {
+		for _, constraint := range interaction.Constraints() {
+			if path == "" || constraint.Path == path {
+				constraints = append(constraints, constraint)
+			}
+		}
+	}
+
+	return c.JSON(http.StatusOK, constraints)
+}
+
+func (a *api) interactionsConstraintsDeleteHandler(c echo.Context) error {
+	interactions, ok := a.filteredInteractions(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, httpresponse.Errorf("interaction %q not found", c.QueryParam("interaction")))
+	}
+
+	for _, interaction := range interactions {
+		removed := interaction.RemoveConstraints(c.QueryParam("path"))
+		interaction.ClearResponseViolations(c.QueryParam("path"))
+		log.Infof("removed %d constraints from interaction '%s'", removed, interaction.Description)
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (a *api) interactionsModifiersGetHandler(c echo.Context) error {
+	interactions, ok := a.filteredInteractions(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, httpresponse.Errorf("interaction %q not found", c.QueryParam("interaction")))
+	}
+
+	path := c.QueryParam("path")
+	modifiers := make([]*interactionModifier, 0)
+	for _, interaction := range interactions {
+		for _, modifier := range interaction.modifiers.Modifiers() {
+			if path == "" || modifier.Path == path {
+				modifiers = append(modifiers, modifier)
+			}
+		}
+	}
+	sort.Slice(modifiers, func(i, j int) bool {
+		return modifiers[i].Key() < modifiers[j].Key()
+	})
+
+	return c.JSON(http.StatusOK, modifiers)
+}
+
+func (a *api) interactionsModifiersDeleteHandler(c echo.Context) error {
+	interactions, ok := a.filteredInteractions(c)
+	if !ok {
+		return c.JSON(http.StatusNotFound, httpresponse.Errorf("interaction %q not found", c.QueryParam("interaction")))
+	}
+
+	for _, interaction := range interactions {
+		removed := interaction.modifiers.RemoveModifiers(c.QueryParam("path"))
+		log.Infof("removed %d modifiers from interaction '%s'", removed, interaction.Description)
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
 func (a *api) sessionHandler(c echo.Context) error {
 	log.Infof("deleting session for %s", a.target)
+	a.scenarios.Clear()
 	return a.ProxyRequest(c)
 }
 
@@ -151,6 +356,8 @@ func (a *api) interactionsDeleteHandler(c echo.Context) error {
 	log.Info("deleting interactions")
 	a.ProxyRequest(c)
 	a.interactions.Clear()
+	a.unmatched.Clear()
+	a.scenarios.Clear()
 	return nil
 }
 
@@ -194,6 +401,38 @@ func (a *api) interactionsGetHandler(c echo.Context) error {
 	return c.JSON(http.StatusOK, interaction)
 }
 
+// responsesVerificationHandler checks that the responses to every interaction satisfied its response constraints,
+// listing the violations of those that did not
+func (a *api) responsesVerificationHandler(c echo.Context) error {
+	var violated []interactionViolations
+	for _, interaction := range a.interactions.Distinct() {
+		if violations := interaction.responseViolations(); len(violations) > 0 {
+			violated = append(violated, interactionViolations{
+				Description: interaction.Description,
+				Alias:       interaction.Alias,
+				Violations:  violations,
+			})
+		}
+	}
+	if len(violated) == 0 {
+		return c.String(http.StatusOK, "Responses matched")
+	}
+	return c.JSON(http.StatusInternalServerError, &constraintsMismatch{
+		APIError:     httpresponse.Error("response constraints do not match"),
+		Interactions: violated,
+	})
+}
+
+func (a *api) unmatchedGetHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, a.unmatched.All())
+}
+
+func (a *api) unmatchedDeleteHandler(c echo.Context) error {
+	log.Info("deleting unmatched requests")
+	a.unmatched.Clear()
+	return c.NoContent(http.StatusOK)
+}
+
 func (a *api) interactionsWaitHandler(c echo.Context) error {
 	waitForCount, err := strconv.Atoi(c.QueryParam("count"))
 	if err != nil {
@@ -254,32 +493,15 @@ func (a *api) interactionsWaitHandler(c echo.Context) error {
 
 type matchedInteraction struct {
 	interaction  *Interaction
+	request      requestDocument
 	attemptCount int
+	states       scenarioStates
 }
 
 func (a *api) indexHandler(c echo.Context) error {
 	req := c.Request()
 	log.Infof("proxying %s %s %+v", req.Method, req.URL.Path, req.Header)
 
-	mediaType, err := parseMediaTypeHeader(req.Header)
-	if err != nil {
-		return c.JSON(http.StatusBadRequest, httpresponse.Errorf("failed to parse Content-Type header. %s", err.Error()))
-	}
-
-	parseRequest, ok := supportedMediaTypes[mediaType]
-	if !ok {
-		return c.JSON(http.StatusUnsupportedMediaType, httpresponse.Errorf("unsupported Media Type: %s", mediaType))
-	}
-
-	allInteractions, ok := a.interactions.FindAll(req.URL.Path, req.Method)
-	if !ok {
-		if a.forwardUnrecognisedRequests {
-			// No interactions found, pass the request as is to pact mock server.
-			return a.ProxyRequest(c)
-		}
-		return c.JSON(http.StatusBadRequest, httpresponse.Errorf("unable to find interaction to Match '%s %s'", req.Method, req.URL.Path))
-	}
-
 	data, err := io.ReadAll(req.Body)
 	if err != nil {
 		return c.JSON(http.StatusBadRequest, httpresponse.Errorf("unable to read requestDocument data. %s", err.Error()))
@@ -292,55 +514,94 @@ func (a *api) indexHandler(c echo.Context) error {
 
 	req.Body = io.NopCloser(bytes.NewBuffer(data))
 
-	request, err := parseRequest(data, req.URL)
+	mediaType, params, err := parseMediaTypeHeader(req.Header)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, httpresponse.Errorf("unable to read requestDocument data. %s", err.Error()))
+		return a.rejectRequest(c, data, http.StatusBadRequest,
+			httpresponse.Errorf("failed to parse Content-Type header. %s", err.Error()))
 	}
-	h := make(map[string]interface{})
-	for headerName, headerValues := range req.Header {
-		for _, headerValue := range headerValues {
-			h[headerName] = headerValue
+
+	parseRequest := requestParserFor(mediaType)
+
+	allInteractions, ok := a.interactions.FindAll(req.URL.Path, req.Method, req.URL.Query(), req.Header)
+	if !ok {
+		if a.forwardUnrecognisedRequests && a.backend != BackendStandalone {
+			// No interactions found, pass the request as is to pact mock server.
+			a.mockServerProxy().ServeHTTP(c.Response(), req)
+			return nil
 		}
+		return a.rejectRequest(c, data, http.StatusBadRequest,
+			httpresponse.Errorf("unable to find interaction to Match '%s %s'", req.Method, req.URL.Path))
+	}
+
+	request, err := parseRequest(data, req.URL, params)
+	if err != nil {
+		return a.rejectRequest(c, data, http.StatusInternalServerError,
+			httpresponse.Errorf("unable to read requestDocument data. %s", err.Error()))
 	}
-	request["headers"] = h
+	request["headers"], request["header_values"] = parseHeaders(req.Header)
 
-	unmatched := make(map[string][]string)
+	states := a.scenarios.states()
+	unmatched := make([]interactionViolations, 0)
 	matched := make([]matchedInteraction, 0)
 	for _, interaction := range allInteractions {
-		ok, info := interaction.EvaluateConstraints(request, a.interactions)
+		ok, violations := interaction.EvaluateConstraints(request, a.interactions, states)
 		if ok {
+			interactionRequest := request.copy()
 			matched = append(matched, matchedInteraction{
 				interaction:  interaction,
-				attemptCount: interaction.StoreRequest(request),
+				request:      interactionRequest,
+				attemptCount: interaction.StoreRequest(interactionRequest),
+				states:       states,
 			})
 		} else {
-			unmatched[interaction.Description] = info
+			unmatched = append(unmatched, interactionViolations{
+				Description: interaction.Description,
+				Alias:       interaction.Alias,
+				Violations:  violations,
+			})
 		}
 	}
 
 	if len(unmatched) == len(allInteractions) {
-		for desc, info := range unmatched {
-			results := strings.Join(info, "\n")
-			log.Infof("constraints do not match for '%s'.\n\n%s", desc, results)
+		for _, u := range unmatched {
+			reasons := make([]string, 0, len(u.Violations))
+			for _, v := range u.Violations {
+				reasons = append(reasons, v.Reason)
+			}
+			log.Infof("constraints do not match for '%s'.\n\n%s", u.Description, strings.Join(reasons, "\n"))
 		}
-		return c.JSON(http.StatusBadRequest, httpresponse.Error("constraints do not match"))
+		mismatch := newConstraintsMismatch(unmatched)
+		a.unmatched.Add(newUnmatchedRequest(req, data, mismatch.ErrorMessage, mismatch.Interactions))
+		return c.JSON(http.StatusBadRequest, mismatch)
 	}
 
+	for _, m := range matched {
+		a.scenarios.matched(m.interaction)
+	}
 	a.notify.Notify()
-	a.proxy.ServeHTTP(&ResponseModificationWriter{res: c.Response(), matchedInteractions: matched}, req)
+	if a.backend == BackendStandalone {
+		sort.SliceStable(matched, func(i, j int) bool {
+			return matched[i].interaction.Description < matched[j].interaction.Description
+		})
+		a.serveFromInteraction(&ResponseModificationWriter{ctx: req.Context(), res: c.Response(), matchedInteractions: matched, interactions: a.interactions}, req, matched[0].interaction)
+		return nil
+	}
+	a.mockServerProxy().ServeHTTP(&ResponseModificationWriter{ctx: req.Context(), res: c.Response(), matchedInteractions: matched, interactions: a.interactions}, req)
 	return nil
 }
 
-func parseMediaTypeHeader(header http.Header) (string, error) {
+// rejectRequest records the request in the unmatched journal before responding with the error
+func (a *api) rejectRequest(c echo.Context, body []byte, code int, apiErr *httpresponse.APIError) error {
+	a.unmatched.Add(newUnmatchedRequest(c.Request(), body, apiErr.ErrorMessage, nil))
+	return c.JSON(code, apiErr)
+}
+
+func parseMediaTypeHeader(header http.Header) (string, map[string]string, error) {
 	contentType := header.Get("Content-Type")
 	if contentType == "" {
 		log.Info("Request does not have Content-Type header - defaulting to text/plain")
-		return mediaTypeText, nil
+		return mediaTypeText, nil, nil
 	}
 
-	mediaType, _, err := mime.ParseMediaType(contentType)
-	if err != nil {
-		return "", err
-	}
-	return mediaType, nil
+	return mime.ParseMediaType(contentType)
 }
@@ -1,13 +1,27 @@
 package pactproxy
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -159,3 +173,1367 @@ func TestInteractionsGetHandler(t *testing.T) {
 		})
 	}
 }
+
+func TestIndexHandlerConstraintViolations(t *testing.T) {
+	r := require.New(t)
+
+	i := newInteraction("create-user")
+	i.Description = "a request to create a user"
+	i.Method = http.MethodPost
+	i.pathMatcher = &stringPathMatcher{val: "/users"}
+	i.AddConstraint(interactionConstraint{
+		Interaction: "create-user",
+		Path:        "$.body.name",
+		Format:      "%s",
+		Values:      []interface{}{"sam"},
+	})
+
+	interactions := &Interactions{}
+	interactions.Store(i)
+	a := api{interactions: interactions, notify: NewNotify(), unmatched: &unmatchedRequests{}}
+
+	req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name":"bob"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	c := echo.New().NewContext(req, rec)
+
+	r.NoError(a.indexHandler(c))
+	r.Equal(http.StatusBadRequest, rec.Code)
+	r.JSONEq(`{
+		"error_message": "constraints do not match",
+		"interactions": [{
+			"description": "a request to create a user",
+			"alias": "create-user",
+			"violations": [{
+				"path": "$.body.name",
+				"expected": "sam",
+				"actual": "bob",
+				"reason": "value \"bob\" at path \"$.body.name\" does not match constraint \"sam\""
+			}]
+		}]
+	}`, rec.Body.String())
+}
+
+func TestUnmatchedRequestsJournal(t *testing.T) {
+	r := require.New(t)
+
+	i := newInteraction("create-user")
+	i.Method = http.MethodPost
+	i.pathMatcher = &stringPathMatcher{val: "/users"}
+	i.AddConstraint(interactionConstraint{
+		Interaction: "create-user",
+		Path:        "$.body.name",
+		Format:      "%s",
+		Values:      []interface{}{"sam"},
+	})
+
+	interactions := &Interactions{}
+	interactions.Store(i)
+	a := api{interactions: interactions, notify: NewNotify(), unmatched: &unmatchedRequests{}}
+	e := echo.New()
+
+	for _, tt := range []struct {
+		path        string
+		contentType string
+		body        string
+	}{
+		{path: "/users", contentType: "invalid format", body: "bitmap"},
+		{path: "/addresses", contentType: "application/json", body: `{"name":"sam"}`},
+		{path: "/users?source=test", contentType: "application/json", body: `{"name":"bob"}`},
+	} {
+		req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(tt.body))
+		req.Header.Set("Content-Type", tt.contentType)
+		r.NoError(a.indexHandler(e.NewContext(req, httptest.NewRecorder())))
+	}
+
+	rec := httptest.NewRecorder()
+	r.NoError(a.unmatchedGetHandler(e.NewContext(httptest.NewRequest(http.MethodGet, "/interactions/unmatched", nil), rec)))
+	r.Equal(http.StatusOK, rec.Code)
+
+	var journal []unmatchedRequest
+	r.NoError(json.Unmarshal(rec.Body.Bytes(), &journal))
+	r.Len(journal, 3)
+
+	r.Equal("/users", journal[0].Path)
+	r.Equal("bitmap", journal[0].Body)
+	r.Contains(journal[0].Reason, "failed to parse Content-Type header")
+
+	r.Equal("/addresses", journal[1].Path)
+	r.Equal("unable to find interaction to Match 'POST /addresses'", journal[1].Reason)
+
+	r.Equal(http.MethodPost, journal[2].Method)
+	r.Equal("source=test", journal[2].Query)
+	r.Equal("application/json", journal[2].Headers.Get("Content-Type"))
+	r.Equal("constraints do not match", journal[2].Reason)
+	r.Len(journal[2].Violations, 1)
+	r.Equal("$.body.name", journal[2].Violations[0].Violations[0].Path)
+
+	rec = httptest.NewRecorder()
+	r.NoError(a.unmatchedDeleteHandler(e.NewContext(httptest.NewRequest(http.MethodDelete, "/interactions/unmatched", nil), rec)))
+	r.Equal(http.StatusOK, rec.Code)
+	r.Empty(a.unmatched.All())
+}
+
+func TestInteractionsConstraintsAndModifiersListAndDelete(t *testing.T) {
+	r := require.New(t)
+
+	i := newInteraction("create-user")
+	i.AddConstraint(interactionConstraint{Path: "$.body.age", Format: "%v", Values: []interface{}{30}})
+	i.AddConstraint(interactionConstraint{Interaction: "create-user", Path: "$.body.name", Format: "%s", Values: []interface{}{"sam"}})
+	i.AddConstraint(interactionConstraint{Interaction: "create-user", Path: "$.body.email", Format: "%s", Values: []interface{}{"sam@example.com"}})
+	i.modifiers.AddModifier(&interactionModifier{Interaction: "create-user", Path: "$.status", Value: 500})
+	i.modifiers.AddModifier(&interactionModifier{Interaction: "create-user", Path: "$.body.name", Value: "jim"})
+
+	interactions := &Interactions{}
+	interactions.Store(i)
+	a := api{interactions: interactions, notify: NewNotify()}
+	e := echo.New()
+
+	serve := func(handler echo.HandlerFunc, method, target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r.NoError(handler(e.NewContext(httptest.NewRequest(method, target, nil), rec)))
+		return rec
+	}
+
+	rec := serve(a.interactionsConstraintsGetHandler, http.MethodGet, "/interactions/constraints?interaction=create-user")
+	r.Equal(http.StatusOK, rec.Code)
+	var constraints []interactionConstraint
+	r.NoError(json.Unmarshal(rec.Body.Bytes(), &constraints))
+	r.Len(constraints, 3)
+
+	rec = serve(a.interactionsConstraintsGetHandler, http.MethodGet, "/interactions/constraints?path=$.body.name")
+	r.NoError(json.Unmarshal(rec.Body.Bytes(), &constraints))
+	r.Len(constraints, 1)
+	r.Equal("$.body.name", constraints[0].Path)
+
+	rec = serve(a.interactionsConstraintsGetHandler, http.MethodGet, "/interactions/constraints?interaction=unknown")
+	r.Equal(http.StatusNotFound, rec.Code)
+
+	rec = serve(a.interactionsConstraintsDeleteHandler, http.MethodDelete, "/interactions/constraints?interaction=create-user&path=$.body.name")
+	r.Equal(http.StatusOK, rec.Code)
+	r.Len(i.Constraints(), 2)
+
+	// constraints generated from the pact are not removed
+	serve(a.interactionsConstraintsDeleteHandler, http.MethodDelete, "/interactions/constraints")
+	r.Len(i.Constraints(), 1)
+	r.Equal("$.body.age", i.Constraints()[0].Path)
+
+	rec = serve(a.interactionsModifiersGetHandler, http.MethodGet, "/interactions/modifiers")
+	r.Equal(http.StatusOK, rec.Code)
+	var modifiers []interactionModifier
+	r.NoError(json.Unmarshal(rec.Body.Bytes(), &modifiers))
+	r.Len(modifiers, 2)
+
+	serve(a.interactionsModifiersDeleteHandler, http.MethodDelete, "/interactions/modifiers?path=$.status")
+	r.Len(i.modifiers.Modifiers(), 1)
+	r.Equal("$.body.name", i.modifiers.Modifiers()[0].Path)
+
+	serve(a.interactionsModifiersDeleteHandler, http.MethodDelete, "/interactions/modifiers?interaction=create-user")
+	r.Empty(i.modifiers.Modifiers())
+}
+
+// newTestAPI returns an api that proxies matched requests to upstream
+func newTestAPI(t *testing.T, upstream http.HandlerFunc, interactions ...*Interaction) *api {
+	server := httptest.NewServer(upstream)
+	t.Cleanup(server.Close)
+
+	target, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	a := &api{
+		target:       target,
+		proxy:        httputil.NewSingleHostReverseProxy(target),
+		interactions: &Interactions{},
+		notify:       NewNotify(),
+		unmatched:    &unmatchedRequests{},
+	}
+	for _, i := range interactions {
+		a.interactions.Store(i)
+	}
+	return a
+}
+
+func newRoutedInteraction(alias, method, path string) *Interaction {
+	i := newInteraction(alias)
+	i.Method = method
+	i.pathMatcher = &stringPathMatcher{val: path}
+	return i
+}
+
+func serveIndex(t *testing.T, a *api, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	require.NoError(t, a.indexHandler(echo.New().NewContext(req, rec)))
+	return rec
+}
+
+func TestResponseHeaderModifiers(t *testing.T) {
+	r := require.New(t)
+
+	i := newRoutedInteraction("get-user", http.MethodGet, "/users/1")
+	attempt := 1
+	i.modifiers.AddModifier(&interactionModifier{Interaction: "get-user", Path: "$.headers.Retry-After", Value: 120, Attempt: &attempt})
+	i.modifiers.AddModifier(&interactionModifier{Interaction: "get-user", Path: "$.headers.ETag", Value: "v2"})
+	i.modifiers.AddModifier(&interactionModifier{Interaction: "get-user", Path: "$.headers.X-Remove", Value: nil})
+	i.modifiers.AddModifier(&interactionModifier{Interaction: "get-user", Path: "$.headers.Link", Value: []interface{}{"<a>", "<b>"}})
+
+	a := newTestAPI(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("ETag", "v1")
+		w.Header().Set("X-Remove", "remove me")
+		w.Write([]byte(`{"name":"any"}`))
+	}, i)
+
+	rec := serveIndex(t, a, http.MethodGet, "/users/1", "")
+	r.Equal(http.StatusOK, rec.Code)
+	r.Equal("120", rec.Header().Get("Retry-After"))
+	r.Equal("v2", rec.Header().Get("ETag"))
+	r.Empty(rec.Header().Values("X-Remove"))
+	r.Equal([]string{"<a>", "<b>"}, rec.Header().Values("Link"))
+	r.JSONEq(`{"name":"any"}`, rec.Body.String())
+
+	rec = serveIndex(t, a, http.MethodGet, "/users/1", "")
+	r.Empty(rec.Header().Get("Retry-After"))
+	r.Equal("v2", rec.Header().Get("ETag"))
+}
+
+func TestResponseDelayModifier(t *testing.T) {
+	r := require.New(t)
+
+	i := newRoutedInteraction("get-user", http.MethodGet, "/users/1")
+	attempt := 2
+	i.modifiers.AddModifier(&interactionModifier{Interaction: "get-user", Path: "$.delay", Value: "100ms", Attempt: &attempt})
+
+	a := newTestAPI(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"name":"any"}`))
+	}, i)
+
+	start := time.Now()
+	rec := serveIndex(t, a, http.MethodGet, "/users/1", "")
+	r.Equal(http.StatusOK, rec.Code)
+	r.Less(time.Since(start), 100*time.Millisecond)
+
+	start = time.Now()
+	rec = serveIndex(t, a, http.MethodGet, "/users/1", "")
+	r.Equal(http.StatusOK, rec.Code)
+	r.GreaterOrEqual(time.Since(start), 100*time.Millisecond)
+	r.JSONEq(`{"name":"any"}`, rec.Body.String())
+}
+
+func TestInvalidDelayModifierIsRejected(t *testing.T) {
+	interactions := &Interactions{}
+	interactions.Store(newInteraction("get-user"))
+	a := api{interactions: interactions, notify: NewNotify()}
+
+	req := httptest.NewRequest(http.MethodPost, "/interactions/modifiers",
+		strings.NewReader(`{"interaction":"get-user","path":"$.delay","value":"soon"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	require.NoError(t, a.interactionsModifiersHandler(echo.New().NewContext(req, rec)))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestResponseFaultModifiers(t *testing.T) {
+	tests := []struct {
+		name  string
+		fault string
+		body  string
+		flush bool
+	}{
+		{name: "connection reset", fault: faultConnectionReset, body: `{"name":"any"}`},
+		{name: "empty reply", fault: faultEmptyReply, body: `{"name":"any"}`},
+		{name: "truncated body", fault: faultTruncatedBody, body: `{"name":"any"}`},
+		{name: "content length mismatch", fault: faultContentLengthMismatch, body: `{"name":"any"}`},
+		{name: "truncated empty body", fault: faultTruncatedBody},
+		{name: "content length mismatch with empty body", fault: faultContentLengthMismatch},
+		{name: "truncated body without length", fault: faultTruncatedBody, body: `{"name":"any"}`, flush: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := require.New(t)
+
+			i := newRoutedInteraction("get-user", http.MethodGet, "/users/1")
+			attempt := 1
+			i.modifiers.AddModifier(&interactionModifier{Interaction: "get-user", Path: "$.fault", Value: tt.fault, Attempt: &attempt})
+
+			a := newTestAPI(t, func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				if tt.flush {
+					w.(http.Flusher).Flush()
+				}
+				w.Write([]byte(tt.body))
+			}, i)
+			e := echo.New()
+			e.Any("/*", a.indexHandler)
+			server := httptest.NewServer(e)
+			t.Cleanup(server.Close)
+
+			client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+			res, err := client.Get(server.URL + "/users/1")
+			if err == nil {
+				_, err = io.ReadAll(res.Body)
+				res.Body.Close()
+			}
+			r.Error(err)
+
+			res, err = client.Get(server.URL + "/users/1")
+			r.NoError(err)
+			defer res.Body.Close()
+			body, err := io.ReadAll(res.Body)
+			r.NoError(err)
+			r.Equal(tt.body, string(body))
+		})
+	}
+}
+
+func TestInvalidFaultModifierIsRejected(t *testing.T) {
+	interactions := &Interactions{}
+	interactions.Store(newInteraction("get-user"))
+	a := api{interactions: interactions, notify: NewNotify()}
+
+	req := httptest.NewRequest(http.MethodPost, "/interactions/modifiers",
+		strings.NewReader(`{"interaction":"get-user","path":"$.fault","value":"explode"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+
+	require.NoError(t, a.interactionsModifiersHandler(echo.New().NewContext(req, rec)))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestResponseBodyTemplateModifier(t *testing.T) {
+	r := require.New(t)
+
+	i := newRoutedInteraction("create-payment", http.MethodPost, "/v1/payments")
+	i.modifiers.AddModifier(&interactionModifier{Interaction: "create-payment", Path: "$.body.id", Value: "{{ $.body.id }}"})
+	i.modifiers.AddModifier(&interactionModifier{Interaction: "create-payment", Path: "$.headers.Location", Value: "/v1/payments/{{ $.body.id }}"})
+
+	a := newTestAPI(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"example","status":"pending"}`))
+	}, i)
+
+	rec := serveIndex(t, a, http.MethodPost, "/v1/payments", `{"id":"4a0c4f38"}`)
+	r.Equal(http.StatusOK, rec.Code)
+	r.JSONEq(`{"id":"4a0c4f38","status":"pending"}`, rec.Body.String())
+	r.Equal("/v1/payments/4a0c4f38", rec.Header().Get("Location"))
+}
+
+func TestModifiersWithTemplateErrorsAreSkipped(t *testing.T) {
+	tests := []struct {
+		name     string
+		modifier interactionModifier
+	}{
+		{name: "header", modifier: interactionModifier{Path: "$.headers.Location", Value: "/v1/payments/{{ $.body.missing }}"}},
+		{name: "body", modifier: interactionModifier{Path: "$.body.id", Value: "{{ $.body.missing }}"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := require.New(t)
+
+			i := newRoutedInteraction("create-payment", http.MethodPost, "/v1/payments")
+			modifier := tt.modifier
+			modifier.Interaction = "create-payment"
+			i.modifiers.AddModifier(&modifier)
+			i.modifiers.AddModifier(&interactionModifier{Interaction: "create-payment", Path: "$.body.status", Value: "{{ $.body.status }}"})
+
+			a := newTestAPI(t, func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Header().Set("Location", "/v1/payments/example")
+				w.Write([]byte(`{"id":"example","status":"pending"}`))
+			}, i)
+
+			rec := serveIndex(t, a, http.MethodPost, "/v1/payments", `{"status":"accepted"}`)
+			r.Equal(http.StatusOK, rec.Code)
+			r.Equal("/v1/payments/example", rec.Header().Get("Location"))
+			r.JSONEq(`{"id":"example","status":"accepted"}`, rec.Body.String())
+		})
+	}
+}
+
+func TestConstraintSourcedFromPreviousResponse(t *testing.T) {
+	r := require.New(t)
+
+	create := newRoutedInteraction("create-payment", http.MethodPost, "/payments")
+	create.modifiers.AddModifier(&interactionModifier{Interaction: "create-payment", Path: "$.body.id", Value: "{{ uuid }}"})
+	get := newRoutedInteraction("get-payment", http.MethodGet, "")
+	get.pathMatcher = &regexPathMatcher{val: regexp.MustCompile(`^/payments/[^/]+$`)}
+	get.AddConstraint(interactionConstraint{
+		Interaction: "get-payment",
+		Path:        "$.path",
+		Source:      "create-payment",
+		Format:      "/payments/%v",
+		Values:      []interface{}{"$.response.body.id"},
+	})
+
+	a := newTestAPI(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"example"}`))
+	}, create, get)
+
+	rec := serveIndex(t, a, http.MethodPost, "/payments", `{"amount":10}`)
+	r.Equal(http.StatusOK, rec.Code)
+	var payment map[string]interface{}
+	r.NoError(json.Unmarshal(rec.Body.Bytes(), &payment))
+	r.NotEqual("example", payment["id"])
+
+	r.Equal(http.StatusBadRequest, serveIndex(t, a, http.MethodGet, "/payments/example", "").Code)
+	r.Equal(http.StatusOK, serveIndex(t, a, http.MethodGet, fmt.Sprintf("/payments/%v", payment["id"]), "").Code)
+
+	response, ok := create.lastRequest()["response"].(map[string]interface{})
+	r.True(ok)
+	r.Equal(http.StatusOK, response["status"])
+	r.Equal(payment, response["body"])
+}
+
+func TestResponsesAreStoredOnTheRequestOfEachMatchedInteraction(t *testing.T) {
+	r := require.New(t)
+
+	first := newRoutedInteraction("first", http.MethodPost, "/payments")
+	second := newRoutedInteraction("second", http.MethodPost, "/payments")
+	a := newTestAPI(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"1"}`))
+	}, first, second)
+
+	var wg sync.WaitGroup
+	for n := 0; n < 10; n++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			serveIndex(t, a, http.MethodPost, "/payments", `{"amount":10}`)
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := json.Marshal(first)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	r.Equal(10, first.getRequestCount())
+	r.Contains(first.lastRequest(), "response")
+	r.Contains(second.lastRequest(), "response")
+	delete(first.LastRequest, "response")
+	r.Contains(second.lastRequest(), "response")
+}
+
+func TestMultiValueQueryAndHeaderConstraints(t *testing.T) {
+	tests := []struct {
+		name       string
+		constraint interactionConstraint
+		matches    bool
+	}{
+		{name: "scalar query keeps the first value", constraint: interactionConstraint{Path: "$.query.status", Format: "%v", Values: []interface{}{"a"}}, matches: true},
+		{name: "query value by index", constraint: interactionConstraint{Path: "$.query_values.status[1]", Format: "%v", Values: []interface{}{"b"}}, matches: true},
+		{name: "query values contain", constraint: interactionConstraint{Path: "$.query_values.status", Operator: operatorContains, Values: []interface{}{"b"}}, matches: true},
+		{name: "query values do not contain", constraint: interactionConstraint{Path: "$.query_values.status", Operator: operatorContains, Values: []interface{}{"c"}}, matches: false},
+		{name: "query values length", constraint: interactionConstraint{Path: "$.query_values.status", Format: fmtLen, Values: []interface{}{2}}, matches: true},
+		{name: "whole set of header values", constraint: interactionConstraint{Path: "$.header_values.Accept", Format: "%v", Values: []interface{}{"[text/plain application/json]"}}, matches: true},
+		{name: "scalar header keeps the last value", constraint: interactionConstraint{Path: "$.headers.Accept", Format: "%v", Values: []interface{}{"application/json"}}, matches: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := newRoutedInteraction("list-payments", http.MethodGet, "/payments")
+			tt.constraint.Interaction = "list-payments"
+			i.AddConstraint(tt.constraint)
+
+			a := newTestAPI(t, func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`[]`))
+			}, i)
+
+			req := httptest.NewRequest(http.MethodGet, "/payments?status=a&status=b", nil)
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Add("Accept", "text/plain")
+			req.Header.Add("Accept", "application/json")
+			rec := httptest.NewRecorder()
+			require.NoError(t, a.indexHandler(echo.New().NewContext(req, rec)))
+
+			if tt.matches {
+				assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+			} else {
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			}
+		})
+	}
+}
+
+func TestFormRequestConstraints(t *testing.T) {
+	multipartBody := "--XyZ\r\n" +
+		"Content-Disposition: form-data; name=\"type\"\r\n\r\nstatement\r\n" +
+		"--XyZ\r\n" +
+		"Content-Disposition: form-data; name=\"file\"; filename=\"statement.pdf\"\r\n" +
+		"Content-Type: application/pdf\r\n\r\n%PDF-1.4\r\n" +
+		"--XyZ--\r\n"
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		constraints []interactionConstraint
+	}{
+		{
+			name:        "url-encoded form",
+			contentType: "application/x-www-form-urlencoded",
+			body:        "grant_type=client_credentials&scope=a&scope=b",
+			constraints: []interactionConstraint{
+				{Path: "$.body.grant_type", Format: "%v", Values: []interface{}{"client_credentials"}},
+				{Path: "$.body_values.scope[1]", Format: "%v", Values: []interface{}{"b"}},
+			},
+		},
+		{
+			name:        "multipart form",
+			contentType: "multipart/form-data; boundary=XyZ",
+			body:        multipartBody,
+			constraints: []interactionConstraint{
+				{Path: "$.body.type", Format: "%v", Values: []interface{}{"statement"}},
+				{Path: "$.body.file.filename", Format: "%v", Values: []interface{}{"statement.pdf"}},
+				{Path: "$.body.file.content_type", Format: "%v", Values: []interface{}{"application/pdf"}},
+				{Path: "$.body.file.size", Format: "%v", Values: []interface{}{8}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i := newRoutedInteraction("upload", http.MethodPost, "/form")
+			for _, c := range tt.constraints {
+				i.AddConstraint(c)
+			}
+			a := newTestAPI(t, func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusNoContent)
+			}, i)
+
+			req := httptest.NewRequest(http.MethodPost, "/form", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			rec := httptest.NewRecorder()
+			require.NoError(t, a.indexHandler(echo.New().NewContext(req, rec)))
+			assert.Equal(t, http.StatusNoContent, rec.Code, rec.Body.String())
+		})
+	}
+}
+
+func TestXMLRequestConstraintsAndResponseModifiers(t *testing.T) {
+	r := require.New(t)
+
+	i := newRoutedInteraction("initiate-payment", http.MethodPost, "/payments")
+	i.AddConstraint(interactionConstraint{Interaction: "initiate-payment", Path: "$.body_xml.Document.GrpHdr.MsgId", Format: "%v", Values: []interface{}{"MSG-1"}})
+	i.AddConstraint(interactionConstraint{Interaction: "initiate-payment", Path: `$.body_xml.Document.Tx[1].Amt["@Ccy"]`, Format: "%v", Values: []interface{}{"GBP"}})
+	i.modifiers.AddModifier(&interactionModifier{Interaction: "initiate-payment", Path: "$.body.Report.MsgId", Value: `{{ $.body_xml.Document.GrpHdr.MsgId }}`})
+	i.modifiers.AddModifier(&interactionModifier{Interaction: "initiate-payment", Path: "$.body.Report.Sts['@Code']", Value: "ACSC"})
+
+	a := newTestAPI(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(`<Report><MsgId>example</MsgId><Sts Code="PDNG"/></Report>`))
+	}, i)
+
+	serve := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/payments", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/xml")
+		rec := httptest.NewRecorder()
+		r.NoError(a.indexHandler(echo.New().NewContext(req, rec)))
+		return rec
+	}
+
+	rec := serve(paymentXML)
+	r.Equal(http.StatusOK, rec.Code, rec.Body.String())
+	r.Equal(`<Report><MsgId>MSG-1</MsgId><Sts Code="ACSC"></Sts></Report>`, rec.Body.String())
+
+	rec = serve(strings.Replace(paymentXML, "MSG-1", "MSG-2", 1))
+	r.Equal(http.StatusBadRequest, rec.Code)
+}
+
+func TestBinaryRequestConstraintsAndModifiers(t *testing.T) {
+	r := require.New(t)
+
+	document := []byte("%PDF-1.4 statement")
+	digest := sha256.Sum256(document)
+
+	i := newRoutedInteraction("upload-statement", http.MethodPut, "/statements/1")
+	i.AddConstraint(interactionConstraint{Interaction: "upload-statement", Path: "$.body_size", Format: "%v", Values: []interface{}{len(document)}})
+	i.AddConstraint(interactionConstraint{Interaction: "upload-statement", Path: "$.body_sha256", Format: "%v", Values: []interface{}{hex.EncodeToString(digest[:])}})
+	i.AddConstraint(interactionConstraint{Interaction: "upload-statement", Path: "$.bytes.body", Operator: operatorStartsWith, Values: []interface{}{"JVBER"}})
+	i.modifiers.AddModifier(&interactionModifier{Interaction: "upload-statement", Path: "$.status", Value: 201})
+	i.modifiers.AddModifier(&interactionModifier{Interaction: "upload-statement", Path: "$.bytes.body", Value: base64.StdEncoding.EncodeToString([]byte{0x89, 'P', 'N', 'G'})})
+
+	a := newTestAPI(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("example"))
+	}, i)
+
+	serve := func(contentType string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/statements/1", bytes.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		rec := httptest.NewRecorder()
+		r.NoError(a.indexHandler(echo.New().NewContext(req, rec)))
+		return rec
+	}
+
+	rec := serve("application/pdf", document)
+	r.Equal(http.StatusCreated, rec.Code, rec.Body.String())
+	r.Equal([]byte{0x89, 'P', 'N', 'G'}, rec.Body.Bytes())
+
+	rec = serve("application/octet-stream", []byte("%PDF-1.4 other"))
+	r.Equal(http.StatusBadRequest, rec.Code)
+}
+
+func TestPactMatchingRulesAreEnforced(t *testing.T) {
+	definition := `{
+		"description": "A request to create payments",
+		"request": {
+		  "method": "POST",
+		  "path": "/payments",
+		  "query": "status=pending",
+		  "headers": {"Content-Type": "application/json", "X-Request-Id": "2f1c"},
+		  "body": {
+			"reference": "ref-1",
+			"payments": [{"id": 1, "amount": "10.00", "date": "2021-01-31"}],
+			"metadata": {"source": "api"},
+			"note": "early"
+		  },
+		  "matchingRules": {
+			"query": {"status": {"matchers": [{"match": "regex", "regex": "pending|settled"}]}},
+			"header": {"X-Request-Id": {"matchers": [{"match": "regex", "regex": "[0-9a-f]+"}]}},
+			"body": {
+			  "$.payments": {"matchers": [{"match": "type", "min": 1, "max": 2}]},
+			  "$.payments[*].amount": {"matchers": [{"match": "decimal"}]},
+			  "$.payments[*].date": {"matchers": [{"match": "date", "date": "yyyy-MM-dd"}]},
+			  "$.metadata": {"matchers": [{"match": "values"}]},
+			  "$.note": {"combine": "OR", "matchers": [{"match": "null"}, {"match": "type"}]}
+			}
+		  }
+		}
+	}`
+
+	valid := `{"reference": "ref-1", "payments": [{"id": 7, "amount": "12.50", "date": "2022-12-01"}, {"id": 8, "amount": "1.5", "date": "2022-12-02"}], "metadata": {"channel": "web", "user": "1"}, "note": "late"}`
+	tests := []struct {
+		name    string
+		target  string
+		header  string
+		body    string
+		matches bool
+	}{
+		{name: "values satisfying the rules", target: "/payments?status=settled", header: "a1b2", body: valid, matches: true},
+		{name: "null allowed by combined rule", target: "/payments?status=pending", header: "a1b2", body: strings.Replace(valid, `"late"`, `null`, 1), matches: true},
+		{name: "query not matching regex", target: "/payments?status=failed", header: "a1b2", body: valid},
+		{name: "header not matching regex", target: "/payments?status=pending", header: "XYZ", body: valid},
+		{name: "value without rule differs", target: "/payments?status=pending", header: "a1b2", body: strings.Replace(valid, "ref-1", "ref-2", 1)},
+		{name: "element of wrong type", target: "/payments?status=pending", header: "a1b2", body: strings.Replace(valid, `"id": 7`, `"id": "7"`, 1)},
+		{name: "too many elements", target: "/payments?status=pending", header: "a1b2", body: strings.Replace(valid, `"payments": [`, `"payments": [{"id": 6, "amount": "1.0", "date": "2022-12-01"}, `, 1)},
+		{name: "too few elements", target: "/payments?status=pending", header: "a1b2", body: `{"reference": "ref-1", "payments": [], "metadata": {}, "note": "late"}`},
+		{name: "amount not decimal", target: "/payments?status=pending", header: "a1b2", body: strings.Replace(valid, `"12.50"`, `"12"`, 1)},
+		{name: "date in wrong format", target: "/payments?status=pending", header: "a1b2", body: strings.Replace(valid, `"2022-12-01"`, `"01/12/2022"`, 1)},
+		{name: "object value of wrong type", target: "/payments?status=pending", header: "a1b2", body: strings.Replace(valid, `"user": "1"`, `"user": 1`, 1)},
+		{name: "value of neither combined type", target: "/payments?status=pending", header: "a1b2", body: strings.Replace(valid, `"late"`, `1`, 1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			i, err := LoadInteraction([]byte(definition), "create-payments")
+			require.NoError(t, err)
+
+			a := newTestAPI(t, func(w http.ResponseWriter, _ *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.Write([]byte(`{}`))
+			}, i)
+
+			req := httptest.NewRequest(http.MethodPost, tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("X-Request-Id", tt.header)
+			rec := httptest.NewRecorder()
+			require.NoError(t, a.indexHandler(echo.New().NewContext(req, rec)))
+
+			if tt.matches {
+				assert.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+			} else {
+				assert.Equal(t, http.StatusBadRequest, rec.Code)
+			}
+		})
+	}
+}
+
+func TestRustBackendRegistersPactPerMockServer(t *testing.T) {
+	r := require.New(t)
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id": "7"}`))
+	}))
+	t.Cleanup(mockServer.Close)
+	mockServerURL, err := url.Parse(mockServer.URL)
+	r.NoError(err)
+
+	var adminRequests []string
+	admin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		adminRequests = append(adminRequests, req.Method+" "+req.URL.Path)
+		if req.Method == http.MethodPost && req.URL.Path == "/" {
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"mockServer": {"id": "m1", "port": %s}}`, mockServerURL.Port())
+		}
+	}))
+	t.Cleanup(admin.Close)
+	adminURL, err := url.Parse(admin.URL)
+	r.NoError(err)
+
+	e := echo.New()
+	SetupRoutes(e, &Config{Target: *adminURL, Backend: BackendRust})
+	proxy := httptest.NewServer(e)
+	t.Cleanup(proxy.Close)
+
+	pact := `{
+		"consumer": {"name": "payments-ui"},
+		"provider": {"name": "payments"},
+		"interactions": [
+		  {"type": "Synchronous/HTTP", "description": "A request for a payment",
+		   "request": {"method": "GET", "path": "/payments/7"}, "response": {"status": 200}},
+		  {"type": "Asynchronous/Messages", "description": "A payment event", "contents": {}}
+		],
+		"metadata": {"pactSpecification": {"version": "4.0"}}
+	}`
+	res, err := http.Post(proxy.URL+"/", "application/json", strings.NewReader(pact))
+	r.NoError(err)
+	body, _ := io.ReadAll(res.Body)
+	res.Body.Close()
+	r.Equal(http.StatusCreated, res.StatusCode, string(body))
+	r.Contains(string(body), `"id": "m1"`)
+
+	res, err = http.Get(proxy.URL + "/interactions/details/A%20request%20for%20a%20payment")
+	r.NoError(err)
+	res.Body.Close()
+	r.Equal(http.StatusOK, res.StatusCode)
+
+	res, err = http.Post(proxy.URL+"/interactions/modifiers", "application/json",
+		strings.NewReader(`{"interaction": "A request for a payment", "path": "$.body.id", "value": "8"}`))
+	r.NoError(err)
+	res.Body.Close()
+	r.Equal(http.StatusOK, res.StatusCode)
+
+	res, err = http.Get(proxy.URL + "/payments/7")
+	r.NoError(err)
+	body, _ = io.ReadAll(res.Body)
+	res.Body.Close()
+	r.Equal(http.StatusOK, res.StatusCode)
+	r.JSONEq(`{"id": "8"}`, string(body))
+
+	res, err = http.Post(proxy.URL+"/", "application/json", strings.NewReader(pact))
+	r.NoError(err)
+	body, _ = io.ReadAll(res.Body)
+	res.Body.Close()
+	r.Equal(http.StatusConflict, res.StatusCode)
+	r.Contains(string(body), "mock server m1 is serving a pact already")
+
+	res, err = http.Post(proxy.URL+"/mockserver/m1/verify", "application/json", nil)
+	r.NoError(err)
+	res.Body.Close()
+
+	req, _ := http.NewRequest(http.MethodDelete, proxy.URL+"/mockserver/m2", nil)
+	res, err = http.DefaultClient.Do(req)
+	r.NoError(err)
+	res.Body.Close()
+
+	res, err = http.Get(proxy.URL + "/interactions/details/A%20request%20for%20a%20payment")
+	r.NoError(err)
+	res.Body.Close()
+	r.Equal(http.StatusOK, res.StatusCode)
+
+	req, _ = http.NewRequest(http.MethodDelete, proxy.URL+"/mockserver/m1", nil)
+	res, err = http.DefaultClient.Do(req)
+	r.NoError(err)
+	res.Body.Close()
+	r.Equal([]string{"POST /", "POST /mockserver/m1/verify", "DELETE /mockserver/m2", "DELETE /mockserver/m1"}, adminRequests)
+
+	res, err = http.Get(proxy.URL + "/interactions/details/A%20request%20for%20a%20payment")
+	r.NoError(err)
+	res.Body.Close()
+	r.Equal(http.StatusNotFound, res.StatusCode)
+}
+
+func TestPactFilesArePreloadedAndReloaded(t *testing.T) {
+	r := require.New(t)
+
+	var mu sync.Mutex
+	var registered []string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if req.Header.Get("X-Pact-Mock-Service") != "true" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		switch req.Method {
+		case http.MethodDelete:
+			registered = nil
+		case http.MethodPost:
+			var interaction struct {
+				Description string `json:"description"`
+			}
+			if err := json.NewDecoder(req.Body).Decode(&interaction); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			registered = append(registered, interaction.Description)
+		}
+	}))
+	t.Cleanup(mockServer.Close)
+	target, err := url.Parse(mockServer.URL)
+	r.NoError(err)
+
+	dir := t.TempDir()
+	writePact := func(name string, descriptions ...string) {
+		interactions := make([]map[string]interface{}, 0, len(descriptions))
+		for _, d := range descriptions {
+			interactions = append(interactions, map[string]interface{}{
+				"description": d,
+				"request":     map[string]interface{}{"method": "GET", "path": "/" + strings.ReplaceAll(d, " ", "-")},
+				"response":    map[string]interface{}{"status": 200},
+			})
+		}
+		data, err := json.Marshal(map[string]interface{}{"consumer": map[string]interface{}{"name": "c"}, "interactions": interactions})
+		r.NoError(err)
+		r.NoError(os.WriteFile(filepath.Join(dir, name), data, 0o600))
+	}
+	writePact("a.json", "a payment", "a refund")
+	writePact("b.json", "a statement")
+
+	e := echo.New()
+	SetupRoutes(e, &Config{Target: *target, PactDir: dir, WaitDelay: 10 * time.Millisecond})
+	proxy := httptest.NewServer(e)
+	t.Cleanup(proxy.Close)
+
+	r.Eventually(func() bool {
+		res, err := http.Get(proxy.URL + "/ready")
+		if err != nil {
+			return false
+		}
+		res.Body.Close()
+		return res.StatusCode == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond)
+
+	registeredInteractions := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), registered...)
+	}
+	r.Equal([]string{"a payment", "a refund", "a statement"}, registeredInteractions())
+
+	res, err := http.Get(proxy.URL + "/interactions/details/a%20refund")
+	r.NoError(err)
+	res.Body.Close()
+	r.Equal(http.StatusOK, res.StatusCode)
+
+	writePact("b.json", "a balance")
+	res, err = http.Post(proxy.URL+"/pacts/reload", "application/json", nil)
+	r.NoError(err)
+	res.Body.Close()
+	r.Equal(http.StatusOK, res.StatusCode)
+	r.Equal([]string{"a payment", "a refund", "a balance"}, registeredInteractions())
+
+	res, err = http.Get(proxy.URL + "/interactions/details/a%20statement")
+	r.NoError(err)
+	res.Body.Close()
+	r.Equal(http.StatusNotFound, res.StatusCode)
+
+	var wg sync.WaitGroup
+	for n := 0; n < 5; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err := http.Post(proxy.URL+"/pacts/reload", "application/json", nil)
+			if assert.NoError(t, err) {
+				res.Body.Close()
+				assert.Equal(t, http.StatusOK, res.StatusCode)
+			}
+		}()
+	}
+	wg.Wait()
+	r.Equal([]string{"a payment", "a refund", "a balance"}, registeredInteractions())
+
+	r.NoError(os.WriteFile(filepath.Join(dir, "b.json"), []byte("not a pact"), 0o600))
+	res, err = http.Post(proxy.URL+"/pacts/reload", "application/json", nil)
+	r.NoError(err)
+	res.Body.Close()
+	r.Equal(http.StatusInternalServerError, res.StatusCode)
+
+	res, err = http.Get(proxy.URL + "/ready")
+	r.NoError(err)
+	res.Body.Close()
+	r.Equal(http.StatusServiceUnavailable, res.StatusCode)
+}
+
+func TestStandaloneBackendServesInteractionResponses(t *testing.T) {
+	r := require.New(t)
+
+	e := echo.New()
+	dir := t.TempDir()
+	SetupRoutes(e, &Config{Backend: BackendStandalone, PactOutputDir: dir, WaitDelay: 10 * time.Millisecond})
+	proxy := httptest.NewServer(e)
+	t.Cleanup(proxy.Close)
+
+	interaction := `{
+		"description": "a payment",
+		"request": {"method": "POST", "path": "/v1/payments"},
+		"response": {
+			"status": 201,
+			"headers": {"Location": "http://example.com/v1/payments/1"},
+			"body": {"id": "1", "amount": "10.00"},
+			"generators": {
+				"body": {"$.id": {"type": "Regex", "regex": "PAY-\\d{3}"}},
+				"header": {"Location": {"type": "MockServerURL", "example": "http://example.com/v1/payments/1", "regex": ".*(/v1/payments/\\d+)$"}}
+			}
+		}
+	}`
+	res, err := http.Post(proxy.URL+"/interactions", "application/json", strings.NewReader(interaction))
+	r.NoError(err)
+	res.Body.Close()
+	r.Equal(http.StatusOK, res.StatusCode)
+
+	res, err = http.Get(proxy.URL + "/interactions/verification")
+	r.NoError(err)
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	r.NoError(err)
+	r.Equal(http.StatusInternalServerError, res.StatusCode)
+	r.Contains(string(body), "Missing requests:\n\tPOST /v1/payments")
+
+	res, err = http.Post(proxy.URL+"/v1/payments", "application/json", strings.NewReader(`{}`))
+	r.NoError(err)
+	body, err = io.ReadAll(res.Body)
+	res.Body.Close()
+	r.NoError(err)
+	r.Equal(http.StatusCreated, res.StatusCode)
+	r.Equal(proxy.URL+"/v1/payments/1", res.Header.Get("Location"))
+	var payment map[string]interface{}
+	r.NoError(json.Unmarshal(body, &payment))
+	r.Regexp(`^PAY-\d{3}$`, payment["id"])
+	r.Equal("10.00", payment["amount"])
+
+	res, err = http.Get(proxy.URL + "/interactions/verification")
+	r.NoError(err)
+	res.Body.Close()
+	r.Equal(http.StatusOK, res.StatusCode)
+
+	res, err = http.Get(proxy.URL + "/v1/refunds")
+	r.NoError(err)
+	res.Body.Close()
+	r.Equal(http.StatusBadRequest, res.StatusCode)
+
+	res, err = http.Get(proxy.URL + "/interactions/verification")
+	r.NoError(err)
+	body, err = io.ReadAll(res.Body)
+	res.Body.Close()
+	r.NoError(err)
+	r.Equal(http.StatusInternalServerError, res.StatusCode)
+	r.Contains(string(body), "Unexpected requests:\n\tGET /v1/refunds")
+
+	for _, details := range []string{
+		`{"consumer": {"name": "../Payments"}, "provider": {"name": "Ledger"}}`,
+		`{"consumer": {"name": "Payments"}, "provider": {}}`,
+		`{"consumer": {"name": ""}, "provider": {"name": "Ledger"}}`,
+	} {
+		res, err = http.Post(proxy.URL+"/pact", "application/json", strings.NewReader(details))
+		r.NoError(err)
+		res.Body.Close()
+		r.Equal(http.StatusBadRequest, res.StatusCode, details)
+	}
+
+	res, err = http.Post(proxy.URL+"/pact", "application/json",
+		strings.NewReader(`{"consumer": {"name": "Payments"}, "provider": {"name": "Ledger"}}`))
+	r.NoError(err)
+	res.Body.Close()
+	r.Equal(http.StatusOK, res.StatusCode)
+
+	data, err := os.ReadFile(filepath.Join(dir, "payments-ledger.json"))
+	r.NoError(err)
+	interactions, err := LoadPact(data)
+	r.NoError(err)
+	r.Len(interactions, 1)
+	r.Equal("a payment", interactions[0].Description)
+
+	var pact pactFile
+	r.NoError(json.Unmarshal(data, &pact))
+	r.Equal(map[string]interface{}{"version": pactSpecificationV3}, pact.Metadata["pactSpecification"])
+}
+
+func TestRecordBackendRecordsProviderExchangesIntoPact(t *testing.T) {
+	r := require.New(t)
+
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Request-Id", req.URL.Query().Get("request"))
+		id := strings.TrimPrefix(req.URL.Path, "/v1/payments/")
+		if id == "404" {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"error": "not found"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"id": %s, "currency": "GBP", "items": [%s]}`, id, strings.Repeat(`{"n": 1},`, len(id))+`{"n": 2}`)
+	}))
+	t.Cleanup(provider.Close)
+	target, err := url.Parse(provider.URL)
+	r.NoError(err)
+
+	e := echo.New()
+	SetupRoutes(e, &Config{Target: *target, Backend: BackendRecord})
+	proxy := httptest.NewServer(e)
+	t.Cleanup(proxy.Close)
+
+	for _, path := range []string{"/v1/payments/1?request=a", "/v1/payments/22?request=b", "/v1/payments/404?request=c"} {
+		res, err := http.Get(proxy.URL + path)
+		r.NoError(err)
+		res.Body.Close()
+	}
+
+	readPact := func(path string) map[string]interface{} {
+		res, err := http.Get(proxy.URL + path)
+		r.NoError(err)
+		defer res.Body.Close()
+		r.Equal(http.StatusOK, res.StatusCode)
+		var pact map[string]interface{}
+		r.NoError(json.NewDecoder(res.Body).Decode(&pact))
+		return pact
+	}
+
+	pact := readPact("/pact")
+	interactions := pact["interactions"].([]interface{})
+	r.Len(interactions, 2)
+	r.Equal("GET /v1/payments/{id}", interactions[0].(map[string]interface{})["description"])
+	r.Equal("GET /v1/payments/{id} returning 404", interactions[1].(map[string]interface{})["description"])
+	r.Equal(map[string]interface{}{
+		"method": "GET",
+		"path":   "/v1/payments/1",
+		"query":  "request=a",
+	}, interactions[0].(map[string]interface{})["request"])
+	r.Equal(map[string]interface{}{"version": pactSpecificationV2}, pact["metadata"].(map[string]interface{})["pactSpecification"])
+
+	pact = readPact("/pact?infer=true")
+	interaction := pact["interactions"].([]interface{})[0].(map[string]interface{})
+	r.Equal(map[string]interface{}{
+		"path":  map[string]interface{}{"matchers": []interface{}{map[string]interface{}{"match": "regex", "regex": `^/v1/payments/\d+$`}}},
+		"query": map[string]interface{}{"request": map[string]interface{}{"matchers": []interface{}{map[string]interface{}{"match": "type"}}}},
+	}, interaction["request"].(map[string]interface{})["matchingRules"])
+	r.Equal(map[string]interface{}{
+		"header": map[string]interface{}{"X-Request-Id": map[string]interface{}{"matchers": []interface{}{map[string]interface{}{"match": "type"}}}},
+		"body": map[string]interface{}{
+			"$.id":         map[string]interface{}{"matchers": []interface{}{map[string]interface{}{"match": "integer"}}},
+			"$.items":      map[string]interface{}{"matchers": []interface{}{map[string]interface{}{"match": "type"}}},
+			"$.items[*].n": map[string]interface{}{"matchers": []interface{}{map[string]interface{}{"match": "integer"}}},
+		},
+	}, interaction["response"].(map[string]interface{})["matchingRules"])
+	r.Equal(map[string]interface{}{"version": pactSpecificationV3}, pact["metadata"].(map[string]interface{})["pactSpecification"])
+
+	data, err := json.Marshal(pact)
+	r.NoError(err)
+	loaded, err := LoadPact(data)
+	r.NoError(err)
+	r.Len(loaded, 2)
+
+	req, err := http.NewRequest(http.MethodDelete, proxy.URL+"/session", nil)
+	r.NoError(err)
+	res, err := http.DefaultClient.Do(req)
+	r.NoError(err)
+	res.Body.Close()
+	r.Empty(readPact("/pact")["interactions"])
+}
+
+func TestProviderBackendModifiesVerifierRequests(t *testing.T) {
+	r := require.New(t)
+
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"path":          req.URL.Path,
+			"query":         req.URL.RawQuery,
+			"authorization": req.Header.Get("Authorization"),
+			"interaction":   req.Header.Get(interactionHeader),
+			"body":          string(body),
+		})
+	}))
+	t.Cleanup(provider.Close)
+	target, err := url.Parse(provider.URL)
+	r.NoError(err)
+
+	e := echo.New()
+	SetupRoutes(e, &Config{Target: *target, Backend: BackendProvider})
+	proxy := httptest.NewServer(e)
+	t.Cleanup(proxy.Close)
+
+	for _, interaction := range []string{
+		`{"description": "a payment", "request": {"method": "POST", "path": "/v1/payments"}, "response": {"status": 201}}`,
+		`{"description": "a refund", "request": {"method": "POST", "path": "/v1/refunds"}, "response": {"status": 201}}`,
+	} {
+		res, err := http.Post(proxy.URL+"/interactions", "application/json", strings.NewReader(interaction))
+		r.NoError(err)
+		res.Body.Close()
+		r.Equal(http.StatusOK, res.StatusCode)
+	}
+
+	for _, m := range []string{
+		`{"interaction": "a payment", "path": "$.request.headers.Authorization", "value": "Bearer token-{{ counter }}"}`,
+		`{"interaction": "a payment", "path": "$.request.body.id", "value": "{{ $.body.id }}-1"}`,
+		`{"interaction": "a payment", "path": "$.request.query.tenant", "value": "acme"}`,
+		`{"interaction": "a payment", "path": "$.headers.X-Verified", "value": "true"}`,
+		`{"interaction": "a refund", "path": "$.request.path", "value": "/v2/refunds"}`,
+	} {
+		res, err := http.Post(proxy.URL+"/interactions/modifiers", "application/json", strings.NewReader(m))
+		r.NoError(err)
+		res.Body.Close()
+		r.Equal(http.StatusOK, res.StatusCode)
+	}
+
+	res, err := http.Post(proxy.URL+"/interactions/modifiers", "application/json",
+		strings.NewReader(`{"interaction": "a payment", "path": "$.request.cookies.a", "value": "b"}`))
+	r.NoError(err)
+	res.Body.Close()
+	r.Equal(http.StatusBadRequest, res.StatusCode)
+
+	send := func(path, interaction, body string) (*http.Response, map[string]interface{}) {
+		req, err := http.NewRequest(http.MethodPost, proxy.URL+path, strings.NewReader(body))
+		r.NoError(err)
+		req.Header.Set("Content-Type", "application/json")
+		if interaction != "" {
+			req.Header.Set(interactionHeader, interaction)
+		}
+		res, err := http.DefaultClient.Do(req)
+		r.NoError(err)
+		defer res.Body.Close()
+		var received map[string]interface{}
+		r.NoError(json.NewDecoder(res.Body).Decode(&received))
+		return res, received
+	}
+
+	res, received := send("/v1/payments", "", `{"id":"p"}`)
+	r.Equal("/v1/payments", received["path"])
+	r.Equal("tenant=acme", received["query"])
+	r.Equal("Bearer token-1", received["authorization"])
+	r.JSONEq(`{"id":"p-1"}`, received["body"].(string))
+	r.Equal("true", res.Header.Get("X-Verified"))
+
+	res, received = send("/v1/refunds", "a payment", `{"id":"q"}`)
+	r.Equal("/v1/refunds", received["path"])
+	r.Equal("Bearer token-2", received["authorization"])
+	r.Empty(received["interaction"])
+	r.Equal("true", res.Header.Get("X-Verified"))
+
+	_, received = send("/v1/refunds", "", `{}`)
+	r.Equal("/v2/refunds", received["path"])
+
+	_, received = send("/provider-states", "", `{"state": "a payment exists"}`)
+	r.Equal("/provider-states", received["path"])
+	r.Empty(received["authorization"])
+
+	res, err = http.Post(proxy.URL+"/interactions", "application/json", strings.NewReader(
+		`{"description": "a payment in euros", "request": {"method": "POST", "path": "/v1/payments"}, "response": {"status": 201}}`))
+	r.NoError(err)
+	res.Body.Close()
+	r.Equal(http.StatusOK, res.StatusCode)
+
+	_, received = send("/v1/payments", "", `{"id":"p"}`)
+	r.Empty(received["query"])
+	r.Empty(received["authorization"])
+	r.JSONEq(`{"id":"p"}`, received["body"].(string))
+
+	_, received = send("/v1/payments", "a payment", `{"id":"p"}`)
+	r.Equal("Bearer token-3", received["authorization"])
+
+	details, err := http.Get(proxy.URL + "/interactions/details/a%20payment")
+	r.NoError(err)
+	defer details.Body.Close()
+	var interaction Interaction
+	r.NoError(json.NewDecoder(details.Body).Decode(&interaction))
+	r.Equal(3, interaction.RequestCount)
+}
+
+func TestResponseConstraintsAreCheckedAgainstUpstreamResponse(t *testing.T) {
+	r := require.New(t)
+
+	i := newRoutedInteraction("create-payment", http.MethodPost, "/payments")
+	i.AddConstraint(interactionConstraint{Interaction: "create-payment", Path: "$.body.amount", Format: "%v", Values: []interface{}{"10"}})
+	i.AddConstraint(interactionConstraint{Interaction: "create-payment", Path: "$.response.status",
+		Rule: &matchingRule{Matchers: []pactMatcher{{Match: matchStatusCode, Status: "success"}}}})
+	i.AddConstraint(interactionConstraint{Interaction: "create-payment", Path: "$.response.headers.Location", Format: "%v", Values: []interface{}{"/payments/1"}})
+	i.AddConstraint(interactionConstraint{Interaction: "create-payment", Path: "$.response.body.state", Format: "%v", Values: []interface{}{"completed"}})
+	i.modifiers.AddModifier(&interactionModifier{Interaction: "create-payment", Path: "$.body.state", Value: "completed"})
+
+	state := "pending"
+	a := newTestAPI(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Location", "/payments/1")
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"id":"1","state":%q}`, state)
+	}, i)
+
+	verify := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/interactions/responses/verification", nil)
+		r.NoError(a.responsesVerificationHandler(echo.New().NewContext(req, rec)))
+		return rec
+	}
+
+	rec := serveIndex(t, a, http.MethodPost, "/payments", `{"amount":10}`)
+	r.Equal(http.StatusCreated, rec.Code)
+	r.JSONEq(`{"id":"1","state":"completed"}`, rec.Body.String())
+	r.Len(i.ResponseViolations, 1)
+	r.Equal(1, i.ResponseViolations[0].Attempt)
+	r.Len(i.ResponseViolations[0].Violations, 1)
+	r.Equal("$.response.body.state", i.ResponseViolations[0].Violations[0].Path)
+	r.Equal("pending", i.ResponseViolations[0].Violations[0].Actual)
+
+	res := verify()
+	r.Equal(http.StatusInternalServerError, res.Code)
+	var mismatch constraintsMismatch
+	r.NoError(json.Unmarshal(res.Body.Bytes(), &mismatch))
+	r.Equal("response constraints do not match", mismatch.ErrorMessage)
+	r.Len(mismatch.Interactions, 1)
+	r.Equal("create-payment", mismatch.Interactions[0].Description)
+
+	state = "completed"
+	rec = serveIndex(t, a, http.MethodPost, "/payments", `{"amount":10}`)
+	r.Equal(http.StatusCreated, rec.Code)
+	r.Len(i.ResponseViolations, 1)
+
+	rec = httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodDelete, "/interactions/constraints?interaction=create-payment&path=$.response.body.state", nil)
+	r.NoError(a.interactionsConstraintsDeleteHandler(echo.New().NewContext(req, rec)))
+	r.Equal(http.StatusOK, rec.Code)
+	r.Empty(i.ResponseViolations)
+	r.Equal(http.StatusOK, verify().Code)
+}
+
+func TestResponseBodyConstraintsAreNotCheckedWithoutContentLength(t *testing.T) {
+	r := require.New(t)
+
+	i := newRoutedInteraction("create-payment", http.MethodPost, "/payments")
+	i.AddConstraint(interactionConstraint{Interaction: "create-payment", Path: "$.response.status",
+		Rule: &matchingRule{Matchers: []pactMatcher{{Match: matchStatusCode, Status: "success"}}}})
+	i.AddConstraint(interactionConstraint{Interaction: "create-payment", Path: "$.response.body.state", Format: "%v", Values: []interface{}{"completed"}})
+
+	status := http.StatusCreated
+	a := newTestAPI(t, func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.(http.Flusher).Flush()
+		w.Write([]byte(`{"id":"1","state":"pending"}`))
+	}, i)
+
+	rec := serveIndex(t, a, http.MethodPost, "/payments", `{"amount":10}`)
+	r.Equal(http.StatusCreated, rec.Code)
+	r.JSONEq(`{"id":"1","state":"pending"}`, rec.Body.String())
+	r.Empty(i.ResponseViolations)
+
+	status = http.StatusInternalServerError
+	serveIndex(t, a, http.MethodPost, "/payments", `{"amount":10}`)
+	r.Len(i.ResponseViolations, 1)
+	r.Len(i.ResponseViolations[0].Violations, 1)
+	r.Equal("$.response.status", i.ResponseViolations[0].Violations[0].Path)
+}
+
+func TestScenarioStatesDriveModifiersAndConstraints(t *testing.T) {
+	r := require.New(t)
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if req.Header.Get("X-Pact-Mock-Service") != "" {
+			return
+		}
+		fmt.Fprint(w, `{"id":"1","status":"pending"}`)
+	}))
+	t.Cleanup(mockServer.Close)
+	target, err := url.Parse(mockServer.URL)
+	r.NoError(err)
+
+	e := echo.New()
+	SetupRoutes(e, &Config{Target: *target})
+	proxy := httptest.NewServer(e)
+	t.Cleanup(proxy.Close)
+
+	post := func(path, body string) int {
+		res, err := http.Post(proxy.URL+path, "application/json", strings.NewReader(body))
+		r.NoError(err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+	r.Equal(http.StatusOK, post("/interactions",
+		`{"description": "get payment", "request": {"method": "GET", "path": "/v1/payments/1"}, "response": {"status": 200}}`))
+	r.Equal(http.StatusOK, post("/scenarios",
+		`{"name": "payment", "transitions": [{"interaction": "get payment", "from": "Started", "to": "completed", "after": 3}]}`))
+	r.Equal(http.StatusOK, post("/interactions/modifiers",
+		`{"interaction": "get payment", "path": "$.body.status", "value": "completed", "scenario": "payment", "state": "completed"}`))
+	r.Equal(http.StatusOK, post("/interactions/constraints",
+		`{"interaction": "get payment", "path": "$.headers.Verbose", "format": "%v", "values": ["true"], "scenario": "payment", "state": "audited"}`))
+	r.Equal(http.StatusBadRequest, post("/interactions/modifiers",
+		`{"interaction": "get payment", "path": "$.body.status", "value": "completed", "scenario": "payment"}`))
+	r.Equal(http.StatusBadRequest, post("/scenarios", `{"name": "payment", "transitions": [{"interaction": "get payment"}]}`))
+
+	poll := func(verbose string) (int, string) {
+		req, err := http.NewRequest(http.MethodGet, proxy.URL+"/v1/payments/1", nil)
+		r.NoError(err)
+		if verbose != "" {
+			req.Header.Set("Verbose", verbose)
+		}
+		res, err := http.DefaultClient.Do(req)
+		r.NoError(err)
+		defer res.Body.Close()
+		var payment map[string]interface{}
+		if res.StatusCode == http.StatusOK {
+			r.NoError(json.NewDecoder(res.Body).Decode(&payment))
+		}
+		return res.StatusCode, fmt.Sprintf("%v", payment["status"])
+	}
+	for n := 0; n < 3; n++ {
+		_, status := poll("")
+		r.Equal("pending", status)
+	}
+	_, status := poll("")
+	r.Equal("completed", status)
+
+	scenarios := func() []scenario {
+		res, err := http.Get(proxy.URL + "/scenarios")
+		r.NoError(err)
+		defer res.Body.Close()
+		var result []scenario
+		r.NoError(json.NewDecoder(res.Body).Decode(&result))
+		return result
+	}
+	r.Equal("completed", scenarios()[0].State)
+
+	setState := func(name, state string) int {
+		req, err := http.NewRequest(http.MethodPut, proxy.URL+"/scenarios/"+name+"/state", strings.NewReader(fmt.Sprintf(`{"state": %q}`, state)))
+		r.NoError(err)
+		req.Header.Set("Content-Type", "application/json")
+		res, err := http.DefaultClient.Do(req)
+		r.NoError(err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+	r.Equal(http.StatusOK, setState("payment", "audited"))
+	r.Equal(http.StatusNotFound, setState("refund", "audited"))
+
+	code, _ := poll("")
+	r.Equal(http.StatusBadRequest, code)
+	code, status = poll("true")
+	r.Equal(http.StatusOK, code)
+	r.Equal("pending", status)
+	r.Equal("audited", scenarios()[0].State)
+
+	del := func(path string) int {
+		req, err := http.NewRequest(http.MethodDelete, proxy.URL+path, nil)
+		r.NoError(err)
+		res, err := http.DefaultClient.Do(req)
+		r.NoError(err)
+		res.Body.Close()
+		return res.StatusCode
+	}
+	for _, path := range []string{"/scenarios", "/session", "/interactions"} {
+		r.Equal(http.StatusOK, post("/scenarios", `{"name": "payment"}`))
+		r.Len(scenarios(), 1)
+		r.Equal(http.StatusOK, del(path))
+		r.Empty(scenarios(), "scenarios are kept after DELETE %s", path)
+	}
+}
@@ -0,0 +1,511 @@
+package pactproxy
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/form3tech-oss/pact-proxy/internal/app/httpresponse"
+)
+
+// maxRecordedExchanges bounds the recordings so that a long running proxy does not grow without limit,
+// the oldest exchanges are dropped first
+const maxRecordedExchanges = 1000
+
+// recordedExchange is a request of the consumer and the response of the provider to it
+type recordedExchange struct {
+	method          string
+	path            string
+	query           url.Values
+	requestHeaders  http.Header
+	requestBody     interface{}
+	status          int
+	responseHeaders http.Header
+	responseBody    interface{}
+}
+
+type recordedExchanges struct {
+	mu        sync.RWMutex
+	exchanges []recordedExchange
+}
+
+func (r *recordedExchanges) Add(exchange recordedExchange) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.exchanges = append(r.exchanges, exchange)
+	if len(r.exchanges) > maxRecordedExchanges {
+		r.exchanges = r.exchanges[len(r.exchanges)-maxRecordedExchanges:]
+	}
+}
+
+func (r *recordedExchanges) All() []recordedExchange {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]recordedExchange{}, r.exchanges...)
+}
+
+func (r *recordedExchanges) Clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.exchanges = nil
+}
+
+// recordingResponseWriter passes the response of the provider on to the consumer, keeping a copy of its body
+type recordingResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingResponseWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *recordingResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// recordHandler forwards a request of the consumer to the provider and records the exchange,
+// responses the proxy could not get from the provider are not recorded
+func (a *api) recordHandler(c echo.Context) error {
+	req := c.Request()
+	data, err := io.ReadAll(req.Body)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, httpresponse.Errorf("unable to read request. %s", err.Error()))
+	}
+	req.Body = io.NopCloser(bytes.NewBuffer(data))
+
+	failed := false
+	proxy := *a.proxy
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		log.WithError(err).Errorf("unable to forward %s %s to the provider", r.Method, r.URL.Path)
+		failed = true
+		w.WriteHeader(http.StatusBadGateway)
+	}
+
+	requestHeaders := req.Header.Clone()
+	w := &recordingResponseWriter{ResponseWriter: c.Response()}
+	proxy.ServeHTTP(w, req)
+	if failed {
+		return nil
+	}
+
+	responseHeaders := w.Header().Clone()
+	responseBody := w.body.Bytes()
+	if responseHeaders.Get("Content-Encoding") == "gzip" {
+		if responseBody, err = gunzip(responseBody); err != nil {
+			log.WithError(err).Warnf("unable to record %s %s", req.Method, req.URL.Path)
+			return nil
+		}
+		responseHeaders.Del("Content-Encoding")
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	log.Infof("recorded %s %s, %d", req.Method, req.URL.Path, w.status)
+	a.recordings.Add(recordedExchange{
+		method:          req.Method,
+		path:            req.URL.Path,
+		query:           req.URL.Query(),
+		requestHeaders:  requestHeaders,
+		requestBody:     recordedBody(requestHeaders, data),
+		status:          w.status,
+		responseHeaders: responseHeaders,
+		responseBody:    recordedBody(responseHeaders, responseBody),
+	})
+	return nil
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	if len(data) == 0 {
+		return data, nil
+	}
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to decompress response")
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// recordedBody is the body of a pact interaction, JSON bodies are kept as JSON and others as text
+func recordedBody(header http.Header, data []byte) interface{} {
+	if len(data) == 0 {
+		return nil
+	}
+	mediaType, _, _ := mime.ParseMediaType(header.Get("Content-Type"))
+	if mediaType == mediaTypeJSON || mediaType == mediaTypeJSONAPI || strings.HasSuffix(mediaType, "+json") {
+		var parsed interface{}
+		if err := json.Unmarshal(data, &parsed); err == nil {
+			return parsed
+		}
+	}
+	return string(data)
+}
+
+func (a *api) recordingsDeleteHandler(c echo.Context) error {
+	log.Info("deleting recordings")
+	a.recordings.Clear()
+	a.scenarios.Clear()
+	return c.NoContent(http.StatusOK)
+}
+
+// recordedPactHandler responds with the pact of the recordings, matching rules are inferred from the values
+// that vary between the recordings of an interaction when requested with ?infer=true
+func (a *api) recordedPactHandler(c echo.Context) error {
+	infer, _ := strconv.ParseBool(c.QueryParam("infer"))
+	interactions, err := recordedInteractions(a.recordings.All(), infer)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, httpresponse.Errorf("unable to create pact. %s", err.Error()))
+	}
+	return a.writePact(c, interactions)
+}
+
+// recordedIDSegment matches the segments of a path that identify a resource, numbers and UUIDs
+var recordedIDSegment = regexp.MustCompile(`^(\d+|[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12})$`)
+
+const uuidRegex = `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`
+
+// recordedPathTemplate replaces the identifiers in a path, e.g. "/v1/payments/1" is "/v1/payments/{id}".
+// The regex matches every path of the template.
+func recordedPathTemplate(path string) (template string, regex string) {
+	segments := strings.Split(path, "/")
+	templates := make([]string, len(segments))
+	regexes := make([]string, len(segments))
+	for n, segment := range segments {
+		switch {
+		case !recordedIDSegment.MatchString(segment):
+			templates[n], regexes[n] = segment, regexp.QuoteMeta(segment)
+		case strings.Contains(segment, "-"):
+			templates[n], regexes[n] = "{id}", uuidRegex
+		default:
+			templates[n], regexes[n] = "{id}", `\d+`
+		}
+	}
+	return strings.Join(templates, "/"), "^" + strings.Join(regexes, "/") + "$"
+}
+
+// shape identifies the exchanges that are recorded as one interaction: the same method and path template,
+// query parameters, status and structure of the bodies
+func (e recordedExchange) shape() string {
+	template, _ := recordedPathTemplate(e.path)
+	names := make([]string, 0, len(e.query))
+	for name := range e.query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join([]string{
+		e.method, template, strings.Join(names, "&"), jsonShape(e.requestBody),
+		strconv.Itoa(e.status), jsonShape(e.responseBody),
+	}, " ")
+}
+
+// jsonShape describes the structure of a value without its values, arrays by their first element
+func jsonShape(value interface{}) string {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key, child := range v {
+			keys = append(keys, strconv.Quote(key)+":"+jsonShape(child))
+		}
+		sort.Strings(keys)
+		return "{" + strings.Join(keys, ",") + "}"
+	case []interface{}:
+		if len(v) == 0 {
+			return "[]"
+		}
+		return "[" + jsonShape(v[0]) + "]"
+	}
+	return jsonType(value)
+}
+
+// recordedRequestHeaders are the request headers recorded, others, such as User-Agent, describe the client
+// rather than the request
+var recordedRequestHeaders = []string{"Accept", "Content-Type"}
+
+// unrecordedResponseHeaders are the response headers which differ with every response or describe the connection
+var unrecordedResponseHeaders = map[string]bool{
+	"Connection":        true,
+	"Content-Encoding":  true,
+	"Content-Length":    true,
+	"Date":              true,
+	"Keep-Alive":        true,
+	"Server":            true,
+	"Transfer-Encoding": true,
+}
+
+// recordedInteractions turns the recordings into interactions, one for every shape of exchange in the order
+// they were first recorded. Descriptions are the method and path template, with the status added when a
+// method and path has several.
+func recordedInteractions(exchanges []recordedExchange, inferRules bool) ([]*Interaction, error) {
+	var shapes []string
+	samples := make(map[string][]recordedExchange)
+	for _, e := range exchanges {
+		shape := e.shape()
+		if _, ok := samples[shape]; !ok {
+			shapes = append(shapes, shape)
+		}
+		samples[shape] = append(samples[shape], e)
+	}
+
+	described := make(map[string]bool)
+	interactions := make([]*Interaction, 0, len(shapes))
+	for _, shape := range shapes {
+		first := samples[shape][0]
+		template, _ := recordedPathTemplate(first.path)
+		description := first.method + " " + template
+		if described[description] {
+			description = fmt.Sprintf("%s returning %d", description, first.status)
+		}
+		for n := 2; described[description]; n++ {
+			description = fmt.Sprintf("%s %s returning %d (%d)", first.method, template, first.status, n)
+		}
+		described[description] = true
+
+		data, err := json.Marshal(recordedDefinition(description, samples[shape], inferRules))
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to encode interaction '%s'", description)
+		}
+		interaction, err := LoadInteraction(data, "")
+		if err != nil {
+			return nil, errors.Wrapf(err, "unable to load interaction '%s'", description)
+		}
+		interactions = append(interactions, interaction)
+	}
+	return interactions, nil
+}
+
+// recordedDefinition is the pact interaction of exchanges of the same shape, the first of them is the example.
+// Inferred matching rules are written in the v3 format, which also has the query as a map.
+func recordedDefinition(description string, samples []recordedExchange, inferRules bool) map[string]interface{} {
+	first := samples[0]
+
+	request := map[string]interface{}{
+		"method": first.method,
+		"path":   first.path,
+	}
+	if len(first.query) > 0 {
+		if inferRules {
+			request["query"] = first.query
+		} else {
+			request["query"] = first.query.Encode()
+		}
+	}
+	requestHeaders := map[string]interface{}{}
+	for _, name := range recordedRequestHeaders {
+		if value := first.requestHeaders.Get(name); value != "" {
+			requestHeaders[name] = value
+		}
+	}
+	if len(requestHeaders) > 0 {
+		request["headers"] = requestHeaders
+	}
+	if first.requestBody != nil {
+		request["body"] = first.requestBody
+	}
+
+	response := map[string]interface{}{"status": first.status}
+	responseHeaders := map[string]interface{}{}
+	for name, values := range first.responseHeaders {
+		if !unrecordedResponseHeaders[http.CanonicalHeaderKey(name)] {
+			responseHeaders[name] = strings.Join(values, ", ")
+		}
+	}
+	if len(responseHeaders) > 0 {
+		response["headers"] = responseHeaders
+	}
+	if first.responseBody != nil {
+		response["body"] = first.responseBody
+	}
+
+	if inferRules && len(samples) > 1 {
+		if rules := inferRequestRules(samples); len(rules) > 0 {
+			request["matchingRules"] = rules
+		}
+		if rules := inferResponseRules(samples, responseHeaders); len(rules) > 0 {
+			response["matchingRules"] = rules
+		}
+	}
+
+	return map[string]interface{}{
+		"description": description,
+		"request":     request,
+		"response":    response,
+	}
+}
+
+func inferRequestRules(samples []recordedExchange) map[string]interface{} {
+	rules := map[string]interface{}{}
+
+	first := samples[0]
+	for _, e := range samples[1:] {
+		if e.path != first.path {
+			_, regex := recordedPathTemplate(first.path)
+			rules["path"] = matchers(map[string]interface{}{"match": matchRegex, "regex": regex})
+			break
+		}
+	}
+
+	query := map[string]interface{}{}
+	for name, values := range first.query {
+		for _, e := range samples[1:] {
+			if !reflect.DeepEqual(values, e.query[name]) {
+				query[name] = matchers(map[string]interface{}{"match": matchType})
+				break
+			}
+		}
+	}
+	if len(query) > 0 {
+		rules["query"] = query
+	}
+
+	bodies := make([]interface{}, len(samples))
+	for n, e := range samples {
+		bodies[n] = e.requestBody
+	}
+	if body := inferJSONRules(bodies); len(body) > 0 {
+		rules["body"] = body
+	}
+	return rules
+}
+
+func inferResponseRules(samples []recordedExchange, headers map[string]interface{}) map[string]interface{} {
+	rules := map[string]interface{}{}
+
+	header := map[string]interface{}{}
+	for name, value := range headers {
+		for _, e := range samples[1:] {
+			if strings.Join(e.responseHeaders.Values(name), ", ") != value {
+				header[name] = matchers(map[string]interface{}{"match": matchType})
+				break
+			}
+		}
+	}
+	if len(header) > 0 {
+		rules["header"] = header
+	}
+
+	bodies := make([]interface{}, len(samples))
+	for n, e := range samples {
+		bodies[n] = e.responseBody
+	}
+	if body := inferJSONRules(bodies); len(body) > 0 {
+		rules["body"] = body
+	}
+	return rules
+}
+
+func matchers(rule map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"matchers": []interface{}{rule}}
+}
+
+// inferJSONRules infers the matching rules of bodies from the values that vary between them, keyed by the json
+// path of the value, e.g. "$.items[*].id". Values that are the same in every body are left to match exactly.
+func inferJSONRules(bodies []interface{}) map[string]interface{} {
+	rules := map[string]interface{}{}
+	if _, ok := bodies[0].(string); ok {
+		return rules
+	}
+	inferValueRules("$", bodies, rules)
+	return rules
+}
+
+func inferValueRules(path string, values []interface{}, rules map[string]interface{}) {
+	switch first := values[0].(type) {
+	case map[string]interface{}:
+		for key := range first {
+			children := make([]interface{}, 0, len(values))
+			for _, value := range values {
+				if object, ok := value.(map[string]interface{}); ok {
+					if child, ok := object[key]; ok {
+						children = append(children, child)
+					}
+				}
+			}
+			inferValueRules(ruleChildPath(path, key), children, rules)
+		}
+	case []interface{}:
+		var elements []interface{}
+		for _, value := range values {
+			array, _ := value.([]interface{})
+			if len(array) != len(first) {
+				rules[path] = matchers(map[string]interface{}{"match": matchType})
+			}
+			elements = append(elements, array...)
+		}
+		if len(elements) > 0 {
+			inferValueRules(path+"[*]", elements, rules)
+		}
+	default:
+		if rule, ok := inferScalarRule(values); ok {
+			rules[path] = matchers(rule)
+		}
+	}
+}
+
+var uuidPattern = regexp.MustCompile("^" + uuidRegex + "$")
+
+// inferScalarRule infers the rule of the values when they are of the same type but not all the same,
+// integers and UUIDs are told apart from other numbers and strings
+func inferScalarRule(values []interface{}) (map[string]interface{}, bool) {
+	varies := false
+	for _, value := range values[1:] {
+		if jsonType(value) != jsonType(values[0]) {
+			return nil, false
+		}
+		if value != values[0] {
+			varies = true
+		}
+	}
+	if !varies {
+		return nil, false
+	}
+
+	integers, uuids := true, true
+	for _, value := range values {
+		switch v := value.(type) {
+		case float64:
+			integers = integers && v == float64(int64(v))
+			uuids = false
+		case string:
+			uuids = uuids && uuidPattern.MatchString(v)
+			integers = false
+		default:
+			integers, uuids = false, false
+		}
+	}
+	switch {
+	case integers:
+		return map[string]interface{}{"match": matchInteger}, true
+	case uuids:
+		return map[string]interface{}{"match": matchRegex, "regex": uuidRegex}, true
+	}
+	return map[string]interface{}{"match": matchType}, true
+}
@@ -2,6 +2,7 @@ package pactproxy
 
 import (
 	"encoding/json"
+	"net/http"
 	"net/url"
 	"strings"
 
@@ -10,9 +11,7 @@ import (
 
 type requestDocument map[string]interface{}
 
-func ParseJSONRequest(data []byte, url *url.URL) (requestDocument, error) {
-	queryValues := parseQueryValues(url)
-
+func ParseJSONRequest(data []byte, url *url.URL, _ map[string]string) (requestDocument, error) {
 	body := make(map[string]interface{})
 	if len(data) > 0 {
 		err := json.Unmarshal(data, &body)
@@ -25,39 +24,71 @@ func ParseJSONRequest(data []byte, url *url.URL) (requestDocument, error) {
 				return nil, errors.Wrap(err, "unable to parse RequestDocument body")
 			}
 
-			return map[string]interface{}{
-				"path":  url.Path,
-				"body":  arrayBody,
-				"query": queryValues,
-			}, nil
+			return newRequestDocument(url, arrayBody), nil
 		}
 	}
 
-	return map[string]interface{}{
-		"path":  url.Path,
-		"body":  body,
-		"query": queryValues,
-	}, nil
+	return newRequestDocument(url, body), nil
 }
 
-func ParsePlainTextRequest(data []byte, url *url.URL) (requestDocument, error) {
-	queryValues := parseQueryValues(url)
+func ParsePlainTextRequest(data []byte, url *url.URL, _ map[string]string) (requestDocument, error) {
+	return newRequestDocument(url, string(data)), nil
+}
 
+func newRequestDocument(url *url.URL, body interface{}) requestDocument {
+	query, queryValues := parseQueryValues(url)
 	return map[string]interface{}{
-		"path":  url.Path,
-		"body":  string(data),
-		"query": queryValues,
-	}, nil
+		"path":         url.Path,
+		"body":         body,
+		"query":        query,
+		"query_values": queryValues,
+	}
 }
 
-func parseQueryValues(url *url.URL) map[string]interface{} {
+// parseQueryValues returns the first value of each query parameter, as well as all of its values
+// so that repeated parameters can be constrained as a set or by index
+func parseQueryValues(url *url.URL) (map[string]interface{}, map[string]interface{}) {
+	query := make(map[string]interface{})
 	queryValues := make(map[string]interface{})
 	for q, v := range url.Query() {
 		if len(v) > 0 {
-			escapeValue(queryValues, q, v[0])
+			escapeValue(query, q, v[0])
+			escapeValue(queryValues, q, toInterfaces(v))
+		}
+	}
+	return query, queryValues
+}
+
+// parseHeaders returns the last value of each header, as well as all of its values
+// so that repeated headers can be constrained as a set or by index
+func parseHeaders(header http.Header) (map[string]interface{}, map[string]interface{}) {
+	headers := make(map[string]interface{})
+	headerValues := make(map[string]interface{})
+	for headerName, values := range header {
+		if len(values) > 0 {
+			headers[headerName] = values[len(values)-1]
+			headerValues[headerName] = toInterfaces(values)
 		}
 	}
-	return queryValues
+	return headers, headerValues
+}
+
+func toInterfaces(values []string) []interface{} {
+	result := make([]interface{}, len(values))
+	for i, v := range values {
+		result[i] = v
+	}
+	return result
+}
+
+// copy returns a document of its own for an interaction the request matched, so that storing the response on it
+// does not change the request of other interactions
+func (r requestDocument) copy() requestDocument {
+	request := make(requestDocument, len(r)+1)
+	for k, v := range r {
+		request[k] = v
+	}
+	return request
 }
 
 func (r requestDocument) encodeValues(val string) string {
@@ -77,7 +108,7 @@ func encodeMapValues(m map[string]interface{}, val string) string {
 	return result
 }
 
-func escapeValue(values map[string]interface{}, query, val string) {
+func escapeValue(values map[string]interface{}, query string, val interface{}) {
 	open := strings.Index(query, "[")
 	if open > -1 {
 		key := query[:open]
@@ -0,0 +1,45 @@
+package pactproxy
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+)
+
+type responseDocument map[string]interface{}
+
+// newResponseDocument describes the response returned to the consumer, after modifiers were applied, so that
+// constraints of later interactions can refer to it with "$.response..." paths. Like requests, XML and CSV bodies are
+// kept as text in "body" and parsed into "body_xml" and "body_csv".
+func newResponseDocument(statusCode int, header http.Header, body []byte) responseDocument {
+	headers, headerValues := parseHeaders(header)
+	response := responseDocument{
+		"status":        statusCode,
+		"headers":       headers,
+		"header_values": headerValues,
+		"body":          nil,
+	}
+	if len(body) == 0 {
+		return response
+	}
+	response["body"] = string(body)
+
+	mediaType, _, err := mime.ParseMediaType(header.Get("Content-Type"))
+	switch {
+	case err != nil:
+	case mediaType == mediaTypeJSON || mediaType == mediaTypeJSONAPI:
+		var parsed interface{}
+		if err := json.Unmarshal(body, &parsed); err == nil {
+			response["body"] = parsed
+		}
+	case mediaType == mediaTypeCsv:
+		if parsed, err := parseCSVBody(body); err == nil {
+			response[csvBody] = parsed
+		}
+	case isXMLMediaType(mediaType):
+		if parsed, err := parseXMLBody(body); err == nil {
+			response[xmlBody] = parsed
+		}
+	}
+	return response
+}
@@ -1,16 +1,29 @@
 package pactproxy
 
 import (
+	"context"
 	"io"
+	"mime"
 	"net/http"
 	"strconv"
+
+	log "github.com/sirupsen/logrus"
 )
 
 type ResponseModificationWriter struct {
+	ctx                 context.Context
 	res                 http.ResponseWriter
 	matchedInteractions []matchedInteraction
+	interactions        *Interactions
 	originalResponse    []byte
+	upstreamStatusCode  int
+	upstreamHeader      http.Header
 	statusCode          int
+	wroteHeader         bool
+	contentLength       int
+	contentLengthErr    error
+	fault               string
+	aborted             bool
 }
 
 func (m *ResponseModificationWriter) Header() http.Header {
@@ -18,22 +31,38 @@ func (m *ResponseModificationWriter) Header() http.Header {
 }
 
 func (m *ResponseModificationWriter) Write(b []byte) (int, error) {
-	originalResponseLength, err := strconv.Atoi(m.res.Header().Get("Content-Length"))
-	if err != nil {
-		return 0, err
+	if !m.wroteHeader {
+		m.WriteHeader(http.StatusOK)
+	}
+	if m.aborted {
+		return len(b), nil
+	}
+	if m.contentLengthErr != nil {
+		// without a length it cannot be known when the body is complete, so it is passed on unmodified
+		return m.res.Write(b)
 	}
 
 	m.originalResponse = append(m.originalResponse, b...)
-	if len(m.originalResponse) != originalResponseLength {
+	if len(m.originalResponse) != m.contentLength {
 		return len(b), nil
 	}
+	m.checkResponse(m.originalResponse, true)
 
+	mediaType, _, _ := mime.ParseMediaType(m.Header().Get("Content-Type"))
 	var modifiedBody []byte
 	for _, i := range m.matchedInteractions {
-		modifiedBody, err = i.interaction.modifiers.modifyBody(m.originalResponse, i.attemptCount)
-		if err != nil {
-			return 0, err
-		}
+		modifiedBody = i.interaction.modifiers.modifyBody(m.originalResponse, mediaType, i.request, i.attemptCount, i.states)
+	}
+
+	m.storeResponse(modifiedBody)
+
+	switch m.fault {
+	case faultTruncatedBody:
+		m.Header().Set("Content-Length", strconv.Itoa(len(modifiedBody)))
+		return len(b), m.writeAndAbort(modifiedBody[:len(modifiedBody)/2])
+	case faultContentLengthMismatch:
+		m.Header().Set("Content-Length", strconv.Itoa(len(modifiedBody)+1))
+		return len(b), m.writeAndAbort(modifiedBody)
 	}
 
 	m.Header().Set("Content-Length", strconv.Itoa(len(modifiedBody)))
@@ -50,17 +79,108 @@ func (m *ResponseModificationWriter) Write(b []byte) (int, error) {
 }
 
 func (m *ResponseModificationWriter) WriteHeader(statusCode int) {
+	m.wroteHeader = true
+	m.delay()
+
+	for _, i := range m.matchedInteractions {
+		if fault, ok := i.interaction.modifiers.fault(i.attemptCount, i.states); ok {
+			m.fault = fault
+			break
+		}
+	}
+	if m.fault == faultConnectionReset || m.fault == faultEmptyReply {
+		m.abort(m.fault == faultConnectionReset)
+		return
+	}
+
+	m.upstreamStatusCode, m.upstreamHeader = statusCode, m.Header().Clone()
 	m.statusCode = statusCode
 	for _, i := range m.matchedInteractions {
-		ok, code := i.interaction.modifiers.modifyStatusCode(i.attemptCount)
+		ok, code := i.interaction.modifiers.modifyStatusCode(i.attemptCount, i.states)
 		if ok {
 			m.statusCode = code
 			break
 		}
 	}
 
-	contentLength, err := strconv.Atoi(m.Header().Get("Content-Length"))
-	if err != nil || contentLength == 0 {
+	// the original length is needed to know when the whole body has been received,
+	// so it is read before header modifiers are applied
+	m.contentLength, m.contentLengthErr = strconv.Atoi(m.Header().Get("Content-Length"))
+	for _, i := range m.matchedInteractions {
+		i.interaction.modifiers.modifyHeaders(m.Header(), i.request, i.attemptCount, i.states)
+	}
+
+	if m.contentLengthErr != nil || m.contentLength == 0 {
+		// without a length the body is passed on as it is written, so it is not captured
+		m.checkResponse(nil, m.contentLengthErr == nil)
+		m.storeResponse(nil)
+		if m.fault == faultTruncatedBody || m.fault == faultContentLengthMismatch {
+			// there is no captured body to cut short, so the response declares a byte it never sends
+			m.Header().Set("Content-Length", "1")
+			if err := m.writeAndAbort(nil); err != nil {
+				log.WithError(err).Error("failed to inject network fault")
+			}
+			return
+		}
 		m.res.WriteHeader(m.statusCode)
 	}
 }
+
+// storeResponse records the response on the matched interactions before the consumer receives it,
+// so that a follow-up request can already be constrained by it
+func (m *ResponseModificationWriter) storeResponse(body []byte) {
+	response := newResponseDocument(m.statusCode, m.Header(), body)
+	for _, i := range m.matchedInteractions {
+		i.interaction.StoreResponse(i.request, response)
+	}
+}
+
+// checkResponse checks the response constraints of the matched interactions against the response as it came from
+// upstream, before modifiers were applied, recording any violations on the interactions. Constraints on the body
+// cannot be checked when the body was not captured.
+func (m *ResponseModificationWriter) checkResponse(body []byte, bodyCaptured bool) {
+	response := newResponseDocument(m.upstreamStatusCode, m.upstreamHeader, body)
+	for _, i := range m.matchedInteractions {
+		document := i.request.copy()
+		document["response"] = map[string]interface{}(response)
+
+		if !bodyCaptured && i.interaction.hasResponseBodyConstraints() {
+			log.Warnf("response to attempt %d of interaction '%s' has no Content-Length, constraints on its body are not checked",
+				i.attemptCount, i.interaction.Description)
+		}
+		if ok, violations := i.interaction.EvaluateResponseConstraints(document, m.interactions, i.states, bodyCaptured); !ok {
+			log.Warnf("response to attempt %d of interaction '%s' does not satisfy its response constraints",
+				i.attemptCount, i.interaction.Description)
+			i.interaction.StoreResponseViolations(i.attemptCount, violations)
+		}
+	}
+}
+
+// delay holds the response back when a matched interaction has a delay modifier for the attempt
+func (m *ResponseModificationWriter) delay() {
+	for _, i := range m.matchedInteractions {
+		if delay, ok := i.interaction.modifiers.responseDelay(i.attemptCount, i.states); ok {
+			delay.wait(m.ctx)
+			return
+		}
+	}
+}
+
+// writeAndAbort writes the headers and part of the body before dropping the connection, so the consumer sees a
+// response that ends before the length it declared
+func (m *ResponseModificationWriter) writeAndAbort(body []byte) error {
+	m.res.WriteHeader(m.statusCode)
+	if _, err := m.res.Write(body); err != nil {
+		return err
+	}
+	m.abort(false)
+	return nil
+}
+
+// abort drops the connection to the consumer, subsequent writes are discarded
+func (m *ResponseModificationWriter) abort(reset bool) {
+	m.aborted = true
+	if err := closeConnection(m.res, reset); err != nil {
+		log.WithError(err).Error("failed to inject network fault")
+	}
+}
@@ -0,0 +1,228 @@
+package pactproxy
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// valueMatcher matches the values of a query parameter or header of a request with those of the pact.
+// Values with a regex matching rule must match the regex, values with any other matching rule only need to be
+// present and values without a matching rule must be equal.
+type valueMatcher struct {
+	values []string
+	regex  *regexp.Regexp
+	rule   bool
+	// joined is set for headers the pact holds as a single string, which are matched against the values of the
+	// request joined as a comma separated list
+	joined bool
+}
+
+func (m valueMatcher) match(values []string) bool {
+	switch {
+	case m.regex != nil:
+		for _, v := range values {
+			if !m.regex.MatchString(v) {
+				return false
+			}
+		}
+		return len(values) > 0
+	case m.rule:
+		return len(values) > 0
+	default:
+		if len(values) != len(m.values) {
+			return false
+		}
+		for n := range values {
+			if values[n] != m.values[n] {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// requestRouting narrows down the interactions a request is a candidate for by the query parameters and headers
+// of the pact, so that interactions on the same path are told apart the way the mock server does
+type requestRouting struct {
+	query   map[string]valueMatcher
+	headers map[string]valueMatcher
+}
+
+func newRequestRouting(request, matchingRules map[string]interface{}) (*requestRouting, error) {
+	routing := &requestRouting{
+		query:   map[string]valueMatcher{},
+		headers: map[string]valueMatcher{},
+	}
+
+	query, err := pactQuery(request["query"])
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range query {
+		if routing.query[name], err = newValueMatcher(values, matchingRules, "$.query."+name, "query", name); err != nil {
+			return nil, err
+		}
+	}
+
+	headers, _ := request["headers"].(map[string]interface{})
+	for name, value := range headers {
+		canonical := http.CanonicalHeaderKey(name)
+		values := []string{fmt.Sprintf("%v", value)}
+		array, isArray := value.([]interface{})
+		if isArray {
+			// v4 pacts hold the values of headers in an array
+			values = values[:0]
+			for _, v := range array {
+				values = append(values, fmt.Sprintf("%v", v))
+			}
+		}
+		if canonical == "Content-Type" {
+			values = mediaTypes(values)
+		}
+		matcher, err := newValueMatcher(values, matchingRules, "$.headers."+name, "header", name)
+		if err != nil {
+			return nil, err
+		}
+		matcher.joined = !isArray
+		routing.headers[canonical] = matcher
+	}
+	return routing, nil
+}
+
+// pactQuery reads the query of a pact request, which is a query string in v2 pacts and a map of values in v3 pacts
+func pactQuery(query interface{}) (map[string][]string, error) {
+	switch q := query.(type) {
+	case nil:
+		return nil, nil
+	case string:
+		values, err := url.ParseQuery(q)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to parse interaction query")
+		}
+		return values, nil
+	case map[string]interface{}:
+		values := make(map[string][]string, len(q))
+		for name, value := range q {
+			switch v := value.(type) {
+			case []interface{}:
+				for _, e := range v {
+					values[name] = append(values[name], fmt.Sprintf("%v", e))
+				}
+			default:
+				values[name] = []string{fmt.Sprintf("%v", v)}
+			}
+		}
+		return values, nil
+	}
+	return nil, fmt.Errorf("unable to parse interaction query of type %T", query)
+}
+
+func newValueMatcher(values []string, matchingRules map[string]interface{}, v2Path, v3Category, name string) (valueMatcher, error) {
+	matcher := valueMatcher{values: values}
+
+	rule, ok := findMatchingRule(matchingRules, v2Path, v3Category, name)
+	if !ok {
+		return matcher, nil
+	}
+	matcher.rule = true
+
+	if regex := ruleRegex(rule); regex != "" {
+		compiled, err := regexp.Compile("^" + regex + "$")
+		if err != nil {
+			return valueMatcher{}, errors.Wrapf(err, "unable to parse interaction definition, cannot parse regex rule for %s", name)
+		}
+		matcher.regex = compiled
+	}
+	return matcher, nil
+}
+
+// findMatchingRule looks up the rule for a query parameter or header, either as a v2 rule ("$.query.name") or
+// in the category of v3 rules ("query": {"name": {...}}). Header names are compared case insensitively.
+func findMatchingRule(matchingRules map[string]interface{}, v2Path, v3Category, name string) (map[string]interface{}, bool) {
+	caseInsensitive := v3Category == "header"
+	lookup := func(rules map[string]interface{}, key string) (map[string]interface{}, bool) {
+		for k, v := range rules {
+			if k == key || (caseInsensitive && strings.EqualFold(k, key)) {
+				rule, ok := v.(map[string]interface{})
+				return rule, ok
+			}
+		}
+		return nil, false
+	}
+
+	if rule, ok := lookup(matchingRules, v2Path); ok {
+		return rule, true
+	}
+	if category, ok := matchingRules[v3Category].(map[string]interface{}); ok {
+		return lookup(category, name)
+	}
+	return nil, false
+}
+
+// ruleRegex returns the regex of a v2 rule or of the first v3 matcher with a regex
+func ruleRegex(rule map[string]interface{}) string {
+	if regex, ok := rule["regex"].(string); ok {
+		return regex
+	}
+	matchers, _ := rule["matchers"].([]interface{})
+	for _, m := range matchers {
+		if matcher, ok := m.(map[string]interface{}); ok {
+			if regex, ok := matcher["regex"].(string); ok {
+				return regex
+			}
+		}
+	}
+	return ""
+}
+
+// match reports whether the request has the query parameters of the pact, and no others,
+// and at least the headers of the pact
+func (r *requestRouting) match(query url.Values, header http.Header) bool {
+	if r == nil {
+		return true
+	}
+
+	if len(query) != len(r.query) {
+		return false
+	}
+	for name, matcher := range r.query {
+		if !matcher.match(query[name]) {
+			return false
+		}
+	}
+
+	for name, matcher := range r.headers {
+		values := header.Values(name)
+		if len(values) == 0 {
+			return false
+		}
+		if name == "Content-Type" {
+			values = mediaTypes(values)
+		}
+		if matcher.joined {
+			values = []string{strings.Join(values, ", ")}
+		}
+		if !matcher.match(values) {
+			return false
+		}
+	}
+	return true
+}
+
+// mediaTypes drops the parameters of Content-Type values, which are not compared
+func mediaTypes(values []string) []string {
+	result := make([]string, len(values))
+	for n, v := range values {
+		result[n] = v
+		if mediaType, _, err := mime.ParseMediaType(v); err == nil {
+			result[n] = mediaType
+		}
+	}
+	return result
+}
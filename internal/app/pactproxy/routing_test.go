@@ -0,0 +1,73 @@
+package pactproxy
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindAllRoutesByQueryAndHeaders(t *testing.T) {
+	definitions := []string{
+		`{"description": "pending payments", "request": {"method": "GET", "path": "/payments", "query": "status=pending"}}`,
+		`{"description": "settled payments", "request": {"method": "GET", "path": "/payments", "query": {"status": ["settled"]},
+			"headers": {"Accept": "application/json"}}}`,
+		`{"description": "settled payments as csv", "request": {"method": "GET", "path": "/payments", "query": {"status": ["settled"]},
+			"headers": {"Accept": "text/csv"}}}`,
+		`{"description": "payments since", "request": {"method": "GET", "path": "/payments", "query": "since=2020-01-01",
+			"matchingRules": {"$.query.since": {"regex": "\\d{4}-\\d{2}-\\d{2}"}}}}`,
+		`{"description": "payments page", "request": {"method": "GET", "path": "/payments", "query": {"page": ["1"]},
+			"headers": {"X-Tenant": "a"},
+			"matchingRules": {"query": {"page": {"matchers": [{"match": "integer"}]}}, "header": {"x-tenant": {"matchers": [{"match": "type"}]}}}}}`,
+		`{"description": "payments report", "request": {"method": "GET", "path": "/payments", "query": {"format": ["report"]},
+			"headers": {"Accept": ["application/json", "text/csv"]}}}`,
+	}
+
+	interactions := &Interactions{}
+	for _, d := range definitions {
+		interaction, err := LoadInteraction([]byte(d), "")
+		require.NoError(t, err)
+		interactions.Store(interaction)
+	}
+
+	tests := []struct {
+		name     string
+		query    string
+		header   http.Header
+		expected []string
+	}{
+		{name: "query string", query: "status=pending", expected: []string{"pending payments"}},
+		{name: "query and header", query: "status=settled", header: http.Header{"Accept": {"text/csv"}}, expected: []string{"settled payments as csv"}},
+		{name: "regex rule", query: "since=2021-12-31", expected: []string{"payments since"}},
+		{name: "type rules", query: "page=7", header: http.Header{"X-Tenant": {"b"}}, expected: []string{"payments page"}},
+		{
+			name:     "array valued header",
+			query:    "format=report",
+			header:   http.Header{"Accept": {"application/json", "text/csv"}},
+			expected: []string{"payments report"},
+		},
+		{name: "array valued header missing a value", query: "format=report", header: http.Header{"Accept": {"application/json"}}},
+		{name: "no interaction matches the query", query: "status=unknown"},
+		{name: "no interaction matches the header", query: "status=settled", header: http.Header{"Accept": {"application/xml"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			require.NoError(t, err)
+
+			found, ok := interactions.FindAll("/payments", http.MethodGet, query, tt.header)
+			require.Equal(t, len(tt.expected) > 0, ok)
+
+			var descriptions []string
+			for _, i := range found {
+				descriptions = append(descriptions, i.Description)
+			}
+			sort.Strings(descriptions)
+			assert.Equal(t, tt.expected, descriptions)
+		})
+	}
+}
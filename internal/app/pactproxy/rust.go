@@ -0,0 +1,158 @@
+package pactproxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/form3tech-oss/pact-proxy/internal/app/httpresponse"
+)
+
+// mockServerTarget is the mock server the requests of the consumer are forwarded to. The Rust mock server starts
+// a mock server on a port of its own for every pact, while the Ruby mock service serves them on its admin port.
+type mockServerTarget struct {
+	mu    sync.RWMutex
+	id    string
+	url   *url.URL
+	proxy *httputil.ReverseProxy
+	// registration is held while a pact is registered, the proxy serves a single mock server at a time
+	registration sync.Mutex
+}
+
+func (m *mockServerTarget) set(id string, target *url.URL) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.id, m.url, m.proxy = id, target, httputil.NewSingleHostReverseProxy(target)
+}
+
+// reset forgets the mock server with the id, or any mock server when id is empty, reporting whether it did
+func (m *mockServerTarget) reset(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if id != "" && id != m.id {
+		return false
+	}
+	m.id, m.url, m.proxy = "", nil, nil
+	return true
+}
+
+func (m *mockServerTarget) currentID() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.id
+}
+
+func (m *mockServerTarget) get() *httputil.ReverseProxy {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.proxy
+}
+
+// mockServerProxy returns the proxy to the mock server serving the interactions
+func (a *api) mockServerProxy() *httputil.ReverseProxy {
+	if proxy := a.mockServer.get(); proxy != nil {
+		return proxy
+	}
+	return a.proxy
+}
+
+// rustMockServerResponse is the response of the Rust mock server to a pact, e.g. {"mockServer": {"id": "a1", "port": 1234}}
+type rustMockServerResponse struct {
+	MockServer struct {
+		ID   string `json:"id"`
+		Port int    `json:"port"`
+	} `json:"mockServer"`
+}
+
+// pactPostHandler registers the interactions of the pact of a new mock server with the Rust mock server,
+// requests to the root path that are not a pact are interactions of the consumer
+func (a *api) pactPostHandler(c echo.Context) error {
+	data, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, httpresponse.Errorf("unable to read pact. %s", err.Error()))
+	}
+	c.Request().Body = io.NopCloser(bytes.NewBuffer(data))
+
+	var pact map[string]interface{}
+	if json.Unmarshal(data, &pact) != nil || pact["interactions"] == nil {
+		return a.indexHandler(c)
+	}
+
+	interactions, err := LoadPact(data)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, httpresponse.Errorf("unable to load pact. %s", err.Error()))
+	}
+
+	rec, err := a.registerPact(c.Request(), interactions)
+	if err != nil {
+		return c.JSON(http.StatusConflict, httpresponse.Errorf("unable to register pact. %s", err.Error()))
+	}
+	for name, values := range rec.Header() {
+		c.Response().Header()[name] = values
+	}
+	c.Response().WriteHeader(rec.Code)
+	_, err = c.Response().Write(rec.Body.Bytes())
+	return err
+}
+
+// registerPact passes a pact on to the Rust mock server and, once the mock server is started, stores its
+// interactions in place of those the proxy had and forwards the requests of the consumer to the new mock server.
+// A pact cannot be registered while the proxy serves the mock server of another one.
+func (a *api) registerPact(req *http.Request, interactions []*Interaction) (*httptest.ResponseRecorder, error) {
+	a.mockServer.registration.Lock()
+	defer a.mockServer.registration.Unlock()
+	if id := a.mockServer.currentID(); id != "" {
+		return nil, fmt.Errorf("mock server %s is serving a pact already, delete it before registering another", id)
+	}
+
+	rec := httptest.NewRecorder()
+	a.proxy.ServeHTTP(rec, req)
+	if rec.Code < http.StatusOK || rec.Code >= http.StatusMultipleChoices {
+		return rec, nil
+	}
+
+	a.interactions.Clear()
+	a.unmatched.Clear()
+	for _, interaction := range interactions {
+		log.Infof("storing interaction '%s'", interaction.Description)
+		interaction.recordHistory = a.recordHistory
+		a.interactions.Store(interaction)
+	}
+
+	var created rustMockServerResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err == nil && created.MockServer.Port != 0 {
+		target := *a.target
+		target.Host = net.JoinHostPort(a.target.Hostname(), strconv.Itoa(created.MockServer.Port))
+		log.Infof("forwarding interactions to mock server %s at %s", created.MockServer.ID, target.String())
+		a.mockServer.set(created.MockServer.ID, &target)
+	}
+	return rec, nil
+}
+
+// mockServerDeleteHandler shuts a mock server of the Rust mock server down, along with its interactions when it is
+// the mock server the proxy serves
+func (a *api) mockServerDeleteHandler(c echo.Context) error {
+	id := c.Param("id")
+	log.Infof("deleting mock server %s", id)
+	if err := a.ProxyRequest(c); err != nil {
+		return err
+	}
+	if !a.mockServer.reset(id) {
+		log.Infof("mock server %s is not served by the proxy, its interactions are kept", id)
+		return nil
+	}
+	a.interactions.Clear()
+	a.unmatched.Clear()
+	return nil
+}
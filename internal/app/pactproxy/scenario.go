@@ -0,0 +1,208 @@
+package pactproxy
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/form3tech-oss/pact-proxy/internal/app/httpresponse"
+)
+
+// scenarioStarted is the state a scenario starts in, unless it is created in another
+const scenarioStarted = "Started"
+
+// scenarioTransition moves a scenario from a state to another once an interaction has been matched in the state
+// a number of times, e.g. {"interaction": "get payment", "from": "Started", "to": "completed", "after": 3}.
+// Without a from state it applies in every state, and without after it applies to the first request.
+type scenarioTransition struct {
+	Interaction string `json:"interaction"`
+	From        string `json:"from,omitempty"`
+	To          string `json:"to"`
+	After       int    `json:"after,omitempty"`
+}
+
+// scenario is a named state machine, the modifiers and constraints of interactions can apply in one of its states only
+type scenario struct {
+	Name        string               `json:"name"`
+	State       string               `json:"state"`
+	Transitions []scenarioTransition `json:"transitions,omitempty"`
+	// counts are the requests matched for each transition since the scenario entered its state
+	counts map[int]int
+}
+
+func (s *scenario) validate() error {
+	if s.Name == "" {
+		return fmt.Errorf("scenario has no name")
+	}
+	for n, t := range s.Transitions {
+		if t.Interaction == "" || t.To == "" {
+			return fmt.Errorf("transition %d of scenario %q needs an interaction and a state to move to", n, s.Name)
+		}
+		if t.After < 0 {
+			return fmt.Errorf("transition %d of scenario %q cannot be after %d requests", n, s.Name, t.After)
+		}
+	}
+	return nil
+}
+
+func (s *scenario) setState(state string) {
+	if state != s.State {
+		log.Infof("scenario '%s' moved from '%s' to '%s'", s.Name, s.State, state)
+	}
+	s.State = state
+	s.counts = make(map[int]int)
+}
+
+// scenarioStates are the states of the scenarios when a request was matched
+type scenarioStates map[string]string
+
+// in reports whether the scenario is in the state, which is true of every state when there is no scenario
+func (s scenarioStates) in(scenario, state string) bool {
+	if scenario == "" {
+		return true
+	}
+	current, ok := s[scenario]
+	return ok && current == state
+}
+
+type scenarios struct {
+	mu        sync.Mutex
+	scenarios map[string]*scenario
+}
+
+func newScenarios() *scenarios {
+	return &scenarios{scenarios: make(map[string]*scenario)}
+}
+
+// Store creates the scenario, or replaces the one with its name
+func (s *scenarios) Store(sc *scenario) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sc.State == "" {
+		sc.State = scenarioStarted
+	}
+	sc.counts = make(map[int]int)
+	s.scenarios[sc.Name] = sc
+}
+
+func (s *scenarios) SetState(name, state string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sc, ok := s.scenarios[name]
+	if ok {
+		sc.setState(state)
+	}
+	return ok
+}
+
+// Clear deletes every scenario, so that the constraints and modifiers of its states no longer apply
+func (s *scenarios) Clear() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scenarios = make(map[string]*scenario)
+}
+
+func (s *scenarios) All() []scenario {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	result := make([]scenario, 0, len(s.scenarios))
+	for _, sc := range s.scenarios {
+		result = append(result, scenario{
+			Name:        sc.Name,
+			State:       sc.State,
+			Transitions: append([]scenarioTransition(nil), sc.Transitions...),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// states returns the current state of every scenario
+func (s *scenarios) states() scenarioStates {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states := make(scenarioStates, len(s.scenarios))
+	for name, sc := range s.scenarios {
+		states[name] = sc.State
+	}
+	return states
+}
+
+// matched counts a request matched to the interaction towards the transitions of every scenario in its current
+// state, moving the scenarios whose transitions are due
+func (s *scenarios) matched(interaction *Interaction) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, sc := range s.scenarios {
+		for n, t := range sc.Transitions {
+			if t.Interaction != interaction.Description && (interaction.Alias == "" || t.Interaction != interaction.Alias) {
+				continue
+			}
+			if t.From != "" && t.From != sc.State {
+				continue
+			}
+			sc.counts[n]++
+			if sc.counts[n] >= t.After {
+				sc.setState(t.To)
+				break
+			}
+		}
+	}
+}
+
+func (a *api) scenariosPostHandler(c echo.Context) error {
+	sc := &scenario{}
+	if err := c.Bind(sc); err != nil {
+		return c.JSON(http.StatusBadRequest, httpresponse.Errorf("unable to load scenario. %s", err.Error()))
+	}
+	if err := sc.validate(); err != nil {
+		return c.JSON(http.StatusBadRequest, httpresponse.Errorf("invalid scenario. %s", err.Error()))
+	}
+
+	log.Infof("storing scenario '%s'", sc.Name)
+	a.scenarios.Store(sc)
+	return c.NoContent(http.StatusOK)
+}
+
+func (a *api) scenariosGetHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, a.scenarios.All())
+}
+
+func (a *api) scenariosDeleteHandler(c echo.Context) error {
+	log.Info("deleting scenarios")
+	a.scenarios.Clear()
+	return c.NoContent(http.StatusOK)
+}
+
+func (a *api) scenarioStatePutHandler(c echo.Context) error {
+	var body struct {
+		State string `json:"state"`
+	}
+	if err := c.Bind(&body); err != nil {
+		return c.JSON(http.StatusBadRequest, httpresponse.Errorf("unable to load scenario state. %s", err.Error()))
+	}
+	if body.State == "" {
+		return c.JSON(http.StatusBadRequest, httpresponse.Error("scenario state is required"))
+	}
+
+	name := c.Param("name")
+	if !a.scenarios.SetState(name, body.State) {
+		return c.JSON(http.StatusNotFound, httpresponse.Errorf("unable to find scenario. %s", name))
+	}
+	return c.NoContent(http.StatusOK)
+}
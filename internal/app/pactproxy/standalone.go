@@ -0,0 +1,258 @@
+package pactproxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/form3tech-oss/pact-proxy/internal/app/httpresponse"
+)
+
+// pactResponse generates the response of the interaction from its definition in the pact, applying the generators
+// of the response, as the mock server would
+func (i *Interaction) pactResponse(ctx generatorContext) (int, http.Header, []byte, error) {
+	response, _ := i.definition["response"].(map[string]interface{})
+
+	status := http.StatusOK
+	if s, err := toFloat(response["status"]); err == nil {
+		status = int(s)
+	}
+
+	header := http.Header{}
+	headers, _ := response["headers"].(map[string]interface{})
+	for name, value := range headers {
+		if values, ok := value.([]interface{}); ok {
+			for _, v := range values {
+				header.Add(name, fmt.Sprintf("%v", v))
+			}
+			continue
+		}
+		header.Set(name, fmt.Sprintf("%v", value))
+	}
+
+	body, hasBody := response["body"]
+	if hasBody && i.Type != "" {
+		v4Body, _ := body.(map[string]interface{})
+		if contentType, ok := v4Body["contentType"].(string); ok && header.Get("Content-Type") == "" {
+			header.Set("Content-Type", contentType)
+		}
+		var err error
+		if body, err = v4BodyContent(body); err != nil {
+			return 0, nil, nil, errors.Wrap(err, "unable to read response body")
+		}
+	}
+	// generated values must not change the definition shared by every response
+	body = copyJSONValue(body)
+
+	for path, generator := range i.responseGenerators {
+		generate := func(example interface{}) (interface{}, error) {
+			return generator.generate(example, ctx)
+		}
+		segments := pathSegments(path)
+		switch {
+		case path == "$.status":
+			generated, err := generate(status)
+			if err != nil {
+				return 0, nil, nil, err
+			}
+			if s, err := toFloat(generated); err == nil {
+				status = int(s)
+			}
+		case strings.HasPrefix(path, "$.headers") && len(segments) == 2:
+			generated, err := generate(header.Get(segments[1]))
+			if err != nil {
+				return 0, nil, nil, err
+			}
+			header.Set(segments[1], fmt.Sprintf("%v", generated))
+		case hasBody && len(segments) > 0 && segments[0] == "body":
+			var err error
+			if body, err = applyGenerator(body, segments[1:], generate); err != nil {
+				return 0, nil, nil, err
+			}
+		}
+	}
+
+	if !hasBody || body == nil {
+		return status, header, nil, nil
+	}
+	if text, ok := body.(string); ok {
+		return status, header, []byte(text), nil
+	}
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", mediaTypeJSON)
+	}
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return 0, nil, nil, errors.Wrap(err, "unable to encode response body")
+	}
+	return status, header, encoded, nil
+}
+
+func copyJSONValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, child := range v {
+			result[k] = copyJSONValue(child)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for n, child := range v {
+			result[n] = copyJSONValue(child)
+		}
+		return result
+	}
+	return value
+}
+
+// serveFromInteraction answers a request from the response of the interaction, as standalone proxies have
+// no mock server behind them
+func (a *api) serveFromInteraction(w http.ResponseWriter, req *http.Request, interaction *Interaction) {
+	scheme := "http"
+	if req.TLS != nil {
+		scheme = "https"
+	}
+
+	status, header, body, err := interaction.pactResponse(generatorContext{mockServerURL: scheme + "://" + req.Host})
+	if err != nil {
+		log.WithError(err).Errorf("unable to generate the response of interaction '%s'", interaction.Description)
+		status, header, body = http.StatusInternalServerError, http.Header{}, []byte(err.Error())
+	}
+
+	for name, values := range header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(status)
+	if len(body) == 0 {
+		return
+	}
+	if _, err := w.Write(body); err != nil {
+		log.WithError(err).Warn("unable to write response")
+	}
+}
+
+// interactionsStoreHandler stores an interaction, for backends without a mock server to register it with
+func (a *api) interactionsStoreHandler(c echo.Context) error {
+	data, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, httpresponse.Errorf("unable to read interaction. %s", err.Error()))
+	}
+
+	interaction, err := LoadInteraction(data, c.QueryParam("alias"))
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, httpresponse.Errorf("unable to load interaction. %s", err.Error()))
+	}
+
+	log.Infof("storing interaction '%s'", interaction.Description)
+	interaction.recordHistory = a.recordHistory
+	a.interactions.Store(interaction)
+	return c.String(http.StatusOK, "Registered interaction")
+}
+
+func (a *api) interactionsClearHandler(c echo.Context) error {
+	log.Info("deleting interactions")
+	a.interactions.Clear()
+	a.unmatched.Clear()
+	a.scenarios.Clear()
+	return c.String(http.StatusOK, "Cleared interactions")
+}
+
+// verificationHandler checks that every interaction was requested and that there were no unexpected requests,
+// with the response of the Ruby mock service
+func (a *api) verificationHandler(c echo.Context) error {
+	var missing []string
+	for _, interaction := range a.interactions.Distinct() {
+		if !interaction.HasRequests(1) {
+			request, _ := interaction.definition["request"].(map[string]interface{})
+			missing = append(missing, fmt.Sprintf("\t%s %v", interaction.Method, request["path"]))
+		}
+	}
+	sort.Strings(missing)
+
+	var unexpected []string
+	for _, r := range a.unmatched.All() {
+		unexpected = append(unexpected, fmt.Sprintf("\t%s %s", r.Method, r.Path))
+	}
+
+	if len(missing) == 0 && len(unexpected) == 0 {
+		return c.String(http.StatusOK, "Interactions matched")
+	}
+
+	message := "Actual interactions do not match expected interactions for mock MockService.\n"
+	if len(missing) > 0 {
+		message += "\nMissing requests:\n" + strings.Join(missing, "\n") + "\n"
+	}
+	if len(unexpected) > 0 {
+		message += "\nUnexpected requests:\n" + strings.Join(unexpected, "\n") + "\n"
+	}
+	return c.String(http.StatusInternalServerError, message)
+}
+
+func (a *api) pactWriteHandler(c echo.Context) error {
+	return a.writePact(c, a.interactions.Distinct())
+}
+
+// writePact responds with the pact of the interactions, also writing it to the pact output directory when one is
+// configured, e.g. {"consumer": {"name": "a"}, "provider": {"name": "b"}}
+func (a *api) writePact(c echo.Context, interactions []*Interaction) error {
+	var params struct {
+		Consumer map[string]interface{} `json:"consumer"`
+		Provider map[string]interface{} `json:"provider"`
+	}
+	if c.Request().ContentLength != 0 {
+		if err := json.NewDecoder(c.Request().Body).Decode(&params); err != nil && err != io.EOF {
+			return c.JSON(http.StatusBadRequest, httpresponse.Errorf("unable to read pact details. %s", err.Error()))
+		}
+	}
+
+	pact, err := newPactFile(params.Consumer, params.Provider, interactions)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, httpresponse.Errorf("unable to create pact. %s", err.Error()))
+	}
+	name, err := pactFileName(pact)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, httpresponse.Errorf("invalid pact details. %s", err.Error()))
+	}
+	data, err := json.MarshalIndent(pact, "", "  ")
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, httpresponse.Errorf("unable to create pact. %s", err.Error()))
+	}
+
+	if a.pactOutputDir != "" {
+		path := filepath.Join(a.pactOutputDir, name)
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			return c.JSON(http.StatusInternalServerError, httpresponse.Errorf("unable to write pact. %s", err.Error()))
+		}
+		log.Infof("wrote pact to %s", path)
+	}
+	return c.JSONBlob(http.StatusOK, data)
+}
+
+// pactFileName names the file of the pact after its consumer and provider, which must have names that do not name
+// another directory
+func pactFileName(pact *pactFile) (string, error) {
+	consumer, _ := pact.Consumer["name"].(string)
+	provider, _ := pact.Provider["name"].(string)
+	if consumer == "" || provider == "" {
+		return "", fmt.Errorf("consumer and provider names are required")
+	}
+	for _, participant := range []string{consumer, provider} {
+		if strings.ContainsAny(participant, `/\`) || strings.Contains(participant, "..") {
+			return "", fmt.Errorf("consumer and provider names cannot contain path separators, got %q", participant)
+		}
+	}
+	name := fmt.Sprintf("%s-%s.json", consumer, provider)
+	return strings.ToLower(strings.ReplaceAll(name, " ", "_")), nil
+}
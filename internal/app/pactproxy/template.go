@@ -0,0 +1,126 @@
+package pactproxy
+
+import (
+	"crypto/rand"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/PaesslerAG/jsonpath"
+)
+
+const (
+	templateUUID    = "uuid"
+	templateNow     = "now"
+	templateCounter = "counter"
+)
+
+// templateExpression matches json paths and generators only, other text within braces is left as it is
+var templateExpression = regexp.MustCompile(`{{\s*(` + templateUUID + `|` + templateNow + `|` + templateCounter + `|\$\..*?)\s*}}`)
+
+// responseTemplate renders modifier values that reference the request that was matched, e.g. "{{ $.body.id }}",
+// or generated values: "{{ uuid }}", "{{ now }}" and "{{ counter }}", the number of the attempt
+type responseTemplate struct {
+	request      requestDocument
+	requestCount int
+}
+
+// validateTemplate checks that every json path expression within the value is valid
+func validateTemplate(value interface{}) error {
+	switch v := value.(type) {
+	case string:
+		for _, match := range templateExpression.FindAllStringSubmatch(v, -1) {
+			switch expression := match[1]; expression {
+			case templateUUID, templateNow, templateCounter:
+			default:
+				if _, err := jsonpath.New(expression); err != nil {
+					return fmt.Errorf("invalid template expression %q: %w", expression, err)
+				}
+			}
+		}
+	case map[string]interface{}:
+		for _, e := range v {
+			if err := validateTemplate(e); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, e := range v {
+			if err := validateTemplate(e); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// render replaces the template expressions within the value. A string that is a single expression is replaced by
+// the value it resolves to, keeping its type, otherwise the expressions are formatted into the string.
+func (t responseTemplate) render(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if match := templateExpression.FindStringSubmatch(v); match != nil && match[0] == v {
+			return t.evaluate(match[1])
+		}
+
+		var err error
+		rendered := templateExpression.ReplaceAllStringFunc(v, func(s string) string {
+			resolved, e := t.evaluate(templateExpression.FindStringSubmatch(s)[1])
+			if e != nil {
+				err = e
+			}
+			return fmt.Sprintf("%v", resolved)
+		})
+		return rendered, err
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			var err error
+			if result[k], err = t.render(e); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for n, e := range v {
+			var err error
+			if result[n], err = t.render(e); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	default:
+		return value, nil
+	}
+}
+
+func (t responseTemplate) evaluate(expression string) (interface{}, error) {
+	switch expression {
+	case templateUUID:
+		return newUUID()
+	case templateNow:
+		return time.Now().UTC().Format(time.RFC3339), nil
+	case templateCounter:
+		return t.requestCount, nil
+	}
+
+	if t.request == nil {
+		return nil, fmt.Errorf("template expression %q cannot be resolved without a request", expression)
+	}
+	value, err := jsonpath.Get(t.request.encodeValues(expression), map[string]interface{}(t.request))
+	if err != nil {
+		return nil, fmt.Errorf("template expression %q cannot be resolved within request: %w", expression, err)
+	}
+	return value, nil
+}
+
+func newUUID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
@@ -0,0 +1,69 @@
+package pactproxy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResponseTemplateRender(t *testing.T) {
+	template := responseTemplate{
+		request: requestDocument{
+			"path":  "/v1/payments",
+			"query": map[string]interface{}{"username": "jane"},
+			"body":  map[string]interface{}{"id": "abc", "amount": 10.5},
+		},
+		requestCount: 3,
+	}
+
+	tests := []struct {
+		name     string
+		value    interface{}
+		expected interface{}
+	}{
+		{name: "static value", value: "static", expected: "static"},
+		{name: "other text within braces", value: `{{ name }} is {"a": {{1}}}`, expected: `{{ name }} is {"a": {{1}}}`},
+		{name: "non string value", value: 42, expected: 42},
+		{name: "body value keeps its type", value: "{{ $.body.amount }}", expected: 10.5},
+		{name: "query value", value: "{{$.query.username}}", expected: "jane"},
+		{name: "interpolated values", value: "/v1/payments/{{ $.body.id }}?user={{ $.query.username }}", expected: "/v1/payments/abc?user=jane"},
+		{name: "counter", value: "{{ counter }}", expected: 3},
+		{name: "nested values", value: map[string]interface{}{"ids": []interface{}{"{{ $.body.id }}"}}, expected: map[string]interface{}{"ids": []interface{}{"abc"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, err := template.render(tt.value)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, actual)
+		})
+	}
+}
+
+func TestResponseTemplateGeneratedValues(t *testing.T) {
+	template := responseTemplate{}
+
+	id, err := template.render("{{ uuid }}")
+	require.NoError(t, err)
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, id)
+
+	now, err := template.render("{{ now }}")
+	require.NoError(t, err)
+	_, err = time.Parse(time.RFC3339, now.(string))
+	assert.NoError(t, err)
+}
+
+func TestResponseTemplateUnresolvedPath(t *testing.T) {
+	template := responseTemplate{request: requestDocument{"query": map[string]interface{}{}, "body": map[string]interface{}{}}}
+	_, err := template.render("{{ $.body.missing }}")
+	assert.Error(t, err)
+}
+
+func TestValidateTemplate(t *testing.T) {
+	assert.NoError(t, validateTemplate("{{ $.body.id }} {{ uuid }} {{ now }} {{ counter }}"))
+	assert.NoError(t, validateTemplate([]interface{}{"static", 1}))
+	assert.NoError(t, validateTemplate("{{ random }} {{.Name}}"))
+	assert.Error(t, validateTemplate(map[string]interface{}{"id": "{{ $.body[ }}"}))
+}
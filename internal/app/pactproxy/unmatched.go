@@ -0,0 +1,61 @@
+package pactproxy
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxUnmatchedRequests bounds the journal so that a long running proxy does not grow without limit,
+// the oldest entries are dropped first
+const maxUnmatchedRequests = 1000
+
+type unmatchedRequest struct {
+	Method     string                  `json:"method"`
+	Path       string                  `json:"path"`
+	Query      string                  `json:"query,omitempty"`
+	Headers    http.Header             `json:"headers"`
+	Body       string                  `json:"body"`
+	Timestamp  time.Time               `json:"timestamp"`
+	Reason     string                  `json:"reason"`
+	Violations []interactionViolations `json:"violations,omitempty"`
+}
+
+func newUnmatchedRequest(req *http.Request, body []byte, reason string, violations []interactionViolations) unmatchedRequest {
+	return unmatchedRequest{
+		Method:     req.Method,
+		Path:       req.URL.Path,
+		Query:      req.URL.RawQuery,
+		Headers:    req.Header.Clone(),
+		Body:       string(body),
+		Timestamp:  time.Now().UTC(),
+		Reason:     reason,
+		Violations: violations,
+	}
+}
+
+type unmatchedRequests struct {
+	mu       sync.RWMutex
+	requests []unmatchedRequest
+}
+
+func (u *unmatchedRequests) Add(request unmatchedRequest) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.requests = append(u.requests, request)
+	if len(u.requests) > maxUnmatchedRequests {
+		u.requests = u.requests[len(u.requests)-maxUnmatchedRequests:]
+	}
+}
+
+func (u *unmatchedRequests) All() []unmatchedRequest {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+	return append([]unmatchedRequest{}, u.requests...)
+}
+
+func (u *unmatchedRequests) Clear() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.requests = nil
+}
@@ -0,0 +1,37 @@
+package pactproxy
+
+import (
+	"sort"
+
+	"github.com/form3tech-oss/pact-proxy/internal/app/httpresponse"
+)
+
+type constraintViolation struct {
+	Path     string      `json:"path"`
+	Expected interface{} `json:"expected,omitempty"`
+	Actual   interface{} `json:"actual,omitempty"`
+	Reason   string      `json:"reason"`
+}
+
+type interactionViolations struct {
+	Description string                `json:"description"`
+	Alias       string                `json:"alias,omitempty"`
+	Violations  []constraintViolation `json:"violations"`
+}
+
+// constraintsMismatch is returned to the consumer when a request does not satisfy the constraints
+// of any candidate interaction, so that failures can be diagnosed without the proxy logs
+type constraintsMismatch struct {
+	*httpresponse.APIError
+	Interactions []interactionViolations `json:"interactions"`
+}
+
+func newConstraintsMismatch(unmatched []interactionViolations) *constraintsMismatch {
+	sort.Slice(unmatched, func(i, j int) bool {
+		return unmatched[i].Description < unmatched[j].Description
+	})
+	return &constraintsMismatch{
+		APIError:     httpresponse.Error("constraints do not match"),
+		Interactions: unmatched,
+	}
+}
@@ -0,0 +1,336 @@
+package pactproxy
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	mediaTypeTextXml = "text/xml"
+
+	xmlBody            = "body_xml"
+	xmlAttributePrefix = "@"
+	xmlText            = "#text"
+)
+
+func isXMLMediaType(mediaType string) bool {
+	return mediaType == mediaTypeXml || mediaType == mediaTypeTextXml || strings.HasSuffix(mediaType, "+xml")
+}
+
+// ParseXMLRequest keeps an XML body as text in "$.body" and parses it into "$.body_xml". An element holds its text
+// when it has neither attributes nor child elements, otherwise it holds its child elements by name, its attributes
+// prefixed with "@" and its text as "#text". Repeated elements become arrays. Namespaces are ignored, elements and
+// attributes are keyed by local name. A body that is not well-formed has no "$.body_xml", so it is rejected by
+// constraints rather than by the parser.
+func ParseXMLRequest(data []byte, url *url.URL, _ map[string]string) (requestDocument, error) {
+	request := newRequestDocument(url, string(data))
+	if body, err := parseXMLBody(data); err == nil {
+		request[xmlBody] = body
+	}
+	return request, nil
+}
+
+func parseXMLBody(data []byte) (map[string]interface{}, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil, errors.New("xml document has no root element")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			root, err := decodeXMLElement(decoder, start)
+			if err != nil {
+				return nil, err
+			}
+			return map[string]interface{}{start.Name.Local: root}, nil
+		}
+	}
+}
+
+func decodeXMLElement(decoder *xml.Decoder, start xml.StartElement) (interface{}, error) {
+	element := make(map[string]interface{})
+	for _, attr := range start.Attr {
+		if attr.Name.Space == "xmlns" || attr.Name.Local == "xmlns" {
+			continue
+		}
+		element[xmlAttributePrefix+attr.Name.Local] = attr.Value
+	}
+
+	var text strings.Builder
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			child, err := decodeXMLElement(decoder, t)
+			if err != nil {
+				return nil, err
+			}
+			switch existing := element[t.Name.Local].(type) {
+			case nil:
+				element[t.Name.Local] = child
+			case []interface{}:
+				element[t.Name.Local] = append(existing, child)
+			default:
+				element[t.Name.Local] = []interface{}{existing, child}
+			}
+		case xml.CharData:
+			text.Write(t)
+		case xml.EndElement:
+			value := strings.TrimSpace(text.String())
+			if len(element) == 0 {
+				return value, nil
+			}
+			if value != "" {
+				element[xmlText] = value
+			}
+			return element, nil
+		}
+	}
+}
+
+var xmlRuleKey = regexp.MustCompile(`\['([^']*)'\]|\.([@#][^.\[]+)`)
+
+// xmlMatchingRules rewrites the paths of matching rules on the body, e.g. "$.body.Amt['@Ccy']" or
+// "$.body.Amt.#text", to the paths used by constraints on the parsed body, e.g. "$.body_xml.Amt[\"@Ccy\"]"
+func xmlMatchingRules(rules pactRules) pactRules {
+	result := make(pactRules, len(rules))
+	for path, rule := range rules {
+		result[xmlRulePath(path)] = rule
+	}
+	return result
+}
+
+func xmlRulePath(path string) string {
+	if path == "$.body" || strings.HasPrefix(path, "$.body.") || strings.HasPrefix(path, "$.body[") {
+		path = "$." + xmlBody + strings.TrimPrefix(path, "$.body")
+	}
+	return xmlRuleKey.ReplaceAllStringFunc(path, func(key string) string {
+		key = strings.TrimPrefix(strings.TrimSuffix(strings.TrimPrefix(key, "['"), "']"), ".")
+		return xmlChildPath("", key)
+	})
+}
+
+func xmlChildPath(path, key string) string {
+	if strings.HasPrefix(key, xmlAttributePrefix) || key == xmlText {
+		return path + `["` + key + `"]`
+	}
+	return path + "." + key
+}
+
+// This function adds constraints for the elements, attributes and text of an XML request body. Those which do not
+// have a corresponding matching rule must equal the pact, those which do must satisfy the rule. A rule for the text
+// of an element also applies to an element that only holds text.
+func (i *Interaction) addXMLConstraintsFromPact(path string, rules pactRules, value interface{}) {
+	if rule, hasRule := rules.find(path); hasRule {
+		i.addRuleConstraint(path, rule, value)
+		return
+	}
+	switch val := value.(type) {
+	case map[string]interface{}:
+		for k, v := range val {
+			i.addXMLConstraintsFromPact(xmlChildPath(path, k), rules, v)
+		}
+	case []interface{}:
+		for j := range val {
+			i.addXMLConstraintsFromPact(fmt.Sprintf("%s[%d]", path, j), rules, val[j])
+		}
+		i.AddConstraint(interactionConstraint{
+			Path:   path,
+			Format: fmtLen,
+			Values: []interface{}{len(val)},
+		})
+	default:
+		if rule, hasRule := rules.find(xmlChildPath(path, xmlText)); hasRule {
+			i.addRuleConstraint(path, rule, val)
+			return
+		}
+		i.AddConstraint(interactionConstraint{
+			Path:   path,
+			Format: "%v",
+			Values: []interface{}{val},
+		})
+	}
+}
+
+var (
+	xmlTextEscaper      = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	xmlAttributeEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+)
+
+var xmlPathIndex = regexp.MustCompile(`\[(\d+)\]`)
+var xmlPathQuoted = regexp.MustCompile(`\[['"]([^'"]*)['"]\]`)
+
+type xmlPathStep struct {
+	name  string
+	index int
+}
+
+// xmlPath addresses the text or an attribute of an element of an XML document, using the same paths as
+// constraints, e.g. "Document.Tx[1].Amt" or "Document.Tx.1.Amt['@Ccy']". An element without an index is the first
+// element with that name.
+type xmlPath struct {
+	elements  []xmlPathStep
+	attribute string
+}
+
+func parseXMLPath(path string) (xmlPath, error) {
+	path = xmlPathQuoted.ReplaceAllString(path, ".$1")
+	path = xmlPathIndex.ReplaceAllString(path, ".$1")
+
+	var result xmlPath
+	for _, segment := range strings.Split(path, ".") {
+		if result.attribute != "" {
+			return xmlPath{}, fmt.Errorf("xml path %q continues after the attribute", path)
+		}
+
+		switch {
+		case segment == xmlText:
+		case strings.HasPrefix(segment, xmlAttributePrefix):
+			result.attribute = strings.TrimPrefix(segment, xmlAttributePrefix)
+		default:
+			if index, err := strconv.Atoi(segment); err == nil && len(result.elements) > 0 {
+				result.elements[len(result.elements)-1].index = index
+				continue
+			}
+			if segment == "" {
+				return xmlPath{}, fmt.Errorf("xml path %q has an empty element name", path)
+			}
+			result.elements = append(result.elements, xmlPathStep{name: segment})
+		}
+	}
+
+	if len(result.elements) == 0 {
+		return xmlPath{}, fmt.Errorf("xml path %q does not address an element", path)
+	}
+	return result, nil
+}
+
+type xmlFrame struct {
+	step     xmlPathStep
+	children map[string]int
+}
+
+// modifyXML sets the text or attribute addressed by path to value, replacing the whole content of the element
+// when its text is set. The document is otherwise written back as it was read.
+func modifyXML(data []byte, path string, value interface{}) ([]byte, error) {
+	target, err := parseXMLPath(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	stack := []*xmlFrame{{children: map[string]int{}}}
+	skipDepth := 0
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			return out.Bytes(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			parent := stack[len(stack)-1]
+			frame := &xmlFrame{step: xmlPathStep{name: t.Name.Local, index: parent.children[t.Name.Local]}, children: map[string]int{}}
+			parent.children[t.Name.Local]++
+			stack = append(stack, frame)
+			if skipDepth > 0 {
+				skipDepth++
+				continue
+			}
+
+			matched := target.matches(stack[1:])
+			if matched && target.attribute != "" {
+				t.Attr = setXMLAttribute(t.Attr, target.attribute, fmt.Sprintf("%v", value))
+			}
+			writeXMLStartElement(&out, t)
+			if matched && target.attribute == "" {
+				out.WriteString(xmlTextEscaper.Replace(fmt.Sprintf("%v", value)))
+				skipDepth = 1
+			}
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+			if skipDepth > 1 {
+				skipDepth--
+				continue
+			}
+			skipDepth = 0
+			out.WriteString("</" + xmlName(t.Name) + ">")
+		default:
+			if skipDepth > 0 {
+				continue
+			}
+			writeXMLToken(&out, t)
+		}
+	}
+}
+
+func (p xmlPath) matches(elements []*xmlFrame) bool {
+	if len(elements) != len(p.elements) {
+		return false
+	}
+	for n, e := range elements {
+		if e.step != p.elements[n] {
+			return false
+		}
+	}
+	return true
+}
+
+func setXMLAttribute(attrs []xml.Attr, name, value string) []xml.Attr {
+	for n, attr := range attrs {
+		if attr.Name.Local == name && attr.Name.Space != "xmlns" {
+			attrs[n].Value = value
+			return attrs
+		}
+	}
+	return append(attrs, xml.Attr{Name: xml.Name{Local: name}, Value: value})
+}
+
+func xmlName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+func writeXMLStartElement(out *bytes.Buffer, start xml.StartElement) {
+	out.WriteString("<" + xmlName(start.Name))
+	for _, attr := range start.Attr {
+		out.WriteString(" " + xmlName(attr.Name) + `="`)
+		out.WriteString(xmlAttributeEscaper.Replace(attr.Value))
+		out.WriteString(`"`)
+	}
+	out.WriteString(">")
+}
+
+func writeXMLToken(out *bytes.Buffer, token xml.Token) {
+	switch t := token.(type) {
+	case xml.CharData:
+		out.WriteString(xmlTextEscaper.Replace(string(t)))
+	case xml.Comment:
+		out.WriteString("<!--" + string(t) + "-->")
+	case xml.ProcInst:
+		out.WriteString("<?" + t.Target + " " + string(t.Inst) + "?>")
+	case xml.Directive:
+		out.WriteString("<!" + string(t) + ">")
+	}
+}
@@ -0,0 +1,97 @@
+package pactproxy
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const paymentXML = `<?xml version="1.0" encoding="UTF-8"?>
+<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.001.001.03">
+  <GrpHdr>
+    <MsgId>MSG-1</MsgId>
+  </GrpHdr>
+  <Tx>
+    <Amt Ccy="EUR">10.00</Amt>
+  </Tx>
+  <Tx>
+    <Amt Ccy="GBP">20.00</Amt>
+  </Tx>
+</Document>`
+
+func TestParseXMLBody(t *testing.T) {
+	body, err := parseXMLBody([]byte(paymentXML))
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]interface{}{
+		"Document": map[string]interface{}{
+			"GrpHdr": map[string]interface{}{"MsgId": "MSG-1"},
+			"Tx": []interface{}{
+				map[string]interface{}{"Amt": map[string]interface{}{"@Ccy": "EUR", "#text": "10.00"}},
+				map[string]interface{}{"Amt": map[string]interface{}{"@Ccy": "GBP", "#text": "20.00"}},
+			},
+		},
+	}, body)
+
+	_, err = parseXMLBody([]byte("<Document><MsgId>MSG-1</Document>"))
+	assert.Error(t, err)
+}
+
+func TestParseXMLRequestKeepsBodyText(t *testing.T) {
+	u, err := url.Parse("/payments")
+	require.NoError(t, err)
+
+	request, err := ParseXMLRequest([]byte(paymentXML), u, nil)
+	require.NoError(t, err)
+	assert.Equal(t, paymentXML, request["body"])
+	assert.Equal(t, "MSG-1", request[xmlBody].(map[string]interface{})["Document"].(map[string]interface{})["GrpHdr"].(map[string]interface{})["MsgId"])
+
+	request, err = ParseXMLRequest([]byte("<Document>"), u, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "<Document>", request["body"])
+	assert.NotContains(t, request, xmlBody)
+}
+
+func TestModifyXML(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		value    interface{}
+		expected string
+	}{
+		{name: "element text", path: "Document.GrpHdr.MsgId", value: "MSG-2", expected: `<MsgId>MSG-2</MsgId>`},
+		{name: "indexed element text", path: "Document.Tx[1].Amt", value: 30, expected: `<Amt Ccy="GBP">30</Amt>`},
+		{name: "dot indexed element text", path: "Document.Tx.1.Amt.#text", value: 30, expected: `<Amt Ccy="GBP">30</Amt>`},
+		{name: "attribute", path: "Document.Tx.Amt['@Ccy']", value: "USD", expected: `<Amt Ccy="USD">10.00</Amt>`},
+		{name: "new attribute", path: "Document.GrpHdr.MsgId.@Type", value: `a"b`, expected: `<MsgId Type="a&quot;b">MSG-1</MsgId>`},
+		{name: "escaped text", path: "Document.GrpHdr.MsgId", value: "a<b", expected: `<MsgId>a&lt;b</MsgId>`},
+		{name: "element content", path: "Document.GrpHdr", value: "none", expected: `<GrpHdr>none</GrpHdr>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			modified, err := modifyXML([]byte(paymentXML), tt.path, tt.value)
+			require.NoError(t, err)
+			assert.Contains(t, string(modified), tt.expected)
+			assert.Contains(t, string(modified), `<Document xmlns="urn:iso:std:iso:20022:tech:xsd:pain.001.001.03">`)
+
+			_, err = parseXMLBody(modified)
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestModifyXMLKeepsUnmatchedDocument(t *testing.T) {
+	modified, err := modifyXML([]byte(paymentXML), "Document.Missing", "value")
+	require.NoError(t, err)
+	assert.Equal(t, paymentXML, string(modified))
+}
+
+func TestParseXMLPathErrors(t *testing.T) {
+	for _, path := range []string{"@Ccy", "Document..Amt", "Document.@Ccy.Amt"} {
+		_, err := parseXMLPath(path)
+		assert.Errorf(t, err, "expected %q to be rejected", path)
+	}
+}
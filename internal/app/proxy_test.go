@@ -431,9 +431,79 @@ func TestNonJsonConstraintDoesNotMatch(t *testing.T) {
 	}
 }
 
+type parsedBodyTestCase struct {
+	nonJsonTestCase
+	path  string
+	value string
+}
+
+func createParsedBodyTestCases() map[string]parsedBodyTestCase {
+	return map[string]parsedBodyTestCase{
+		"text/csv column": {
+			nonJsonTestCase: nonJsonTestCase{
+				reqContentType:  "text/csv",
+				reqBody:         "firstname,lastname\nfoo,bar",
+				respContentType: "application/json",
+				respBody:        `{"status":"ok"}`,
+			},
+			path:  "$.body_csv.rows[0].firstname",
+			value: "foo",
+		},
+		"application/xml element": {
+			nonJsonTestCase: nonJsonTestCase{
+				reqContentType:  "application/xml",
+				reqBody:         "<root><firstname>foo</firstname></root>",
+				respContentType: "application/json",
+				respBody:        `{"status":"ok"}`,
+			},
+			path:  "$.body_xml.root.firstname",
+			value: "foo",
+		},
+	}
+}
+
+func TestParsedBodyConstraintMatches(t *testing.T) {
+	for testName, tc := range createParsedBodyTestCases() {
+		t.Run(testName, func(t *testing.T) {
+			given, when, then := NewProxyStage(t)
+
+			given.
+				a_pact_that_expects(tc.reqContentType, tc.reqBody, tc.respContentType, tc.respBody)
+
+			when.
+				an_additional_constraint_is_added(tc.path, tc.value).and().
+				a_request_is_sent_with(tc.reqContentType, tc.reqBody)
+
+			then.
+				pact_verification_is_successful().and().
+				the_response_is_(http.StatusOK).and().
+				the_response_body_is(tc.respBody)
+		})
+	}
+}
+
+func TestParsedBodyConstraintDoesNotMatch(t *testing.T) {
+	for testName, tc := range createParsedBodyTestCases() {
+		t.Run(testName, func(t *testing.T) {
+			given, when, then := NewProxyStage(t)
+
+			given.
+				a_pact_that_expects(tc.reqContentType, tc.reqBody, tc.respContentType, tc.respBody)
+
+			when.
+				an_additional_constraint_is_added(tc.path, "incorrect value").and().
+				a_request_is_sent_with(tc.reqContentType, tc.reqBody)
+
+			then.
+				pact_verification_is_not_successful().and().
+				the_response_is_(http.StatusBadRequest)
+		})
+	}
+}
+
 func TestIncorrectContentTypes(t *testing.T) {
 	for contentType, wantResponse := range map[string]int{
-		"image/bmp":      http.StatusUnsupportedMediaType,
+		"image/bmp":      http.StatusBadRequest,
 		"invalid format": http.StatusBadRequest,
 	} {
 		t.Run(contentType, func(t *testing.T) {
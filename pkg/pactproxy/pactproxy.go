@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -16,6 +17,13 @@ import (
 
 var InteractionNotFoundError = errors.New("interaction not found")
 
+// TestingT is the subset of testing.TB used by the assertion helpers
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+	FailNow()
+}
+
 type PactProxy struct {
 	client http.Client
 	url    string
@@ -23,6 +31,8 @@ type PactProxy struct {
 
 type InteractionSetup struct {
 	interaction string
+	scenario    string
+	state       string
 	pactProxy   *PactProxy
 }
 
@@ -42,13 +52,12 @@ func (p *PactProxy) ForInteraction(interaction string) *InteractionSetup {
 	}
 }
 
-func (p *PactProxy) addConstraint(interaction, pactPath, value string) {
-	b, _ := json.Marshal(map[string]interface{}{
-		"interaction": interaction,
-		"path":        pactPath,
-		"format":      "%s",
-		"values":      []string{value},
-	})
+func (p *PactProxy) addConstraint(s InteractionSetup, pactPath, value string) {
+	b, _ := json.Marshal(s.overlay(map[string]interface{}{
+		"path":   pactPath,
+		"format": "%s",
+		"values": []string{value},
+	}))
 
 	r, _ := http.NewRequest("POST", strings.TrimSuffix(p.url, "/")+"/interactions/constraints", bytes.NewBuffer(b))
 	r.Header.Set("Content-Type", "application/json")
@@ -58,15 +67,40 @@ func (p *PactProxy) addConstraint(interaction, pactPath, value string) {
 	}
 }
 
-func (p *PactProxy) addModifier(interaction, path string, value interface{}, attempt *int) {
-	body := map[string]interface{}{
-		"interaction": interaction,
-		"path":        path,
-		"value":       value,
+func (p *PactProxy) addOperatorConstraint(s InteractionSetup, pactPath, operator string, values []interface{}) {
+	b, err := json.Marshal(s.overlay(map[string]interface{}{
+		"path":     pactPath,
+		"operator": operator,
+		"values":   values,
+	}))
+	if err != nil {
+		panic(err)
+	}
+
+	r, _ := http.NewRequest("POST", strings.TrimSuffix(p.url, "/")+"/interactions/constraints", bytes.NewBuffer(b))
+	r.Header.Set("Content-Type", "application/json")
+	res, err := p.client.Do(r)
+	if err != nil {
+		panic(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(res.Body)
+		panic(fmt.Sprintf("failed to add %s constraint. %d %s", operator, res.StatusCode, body))
 	}
+}
+
+func (p *PactProxy) addModifier(s InteractionSetup, path string, value interface{}, attempt *int, attempts string) {
+	body := s.overlay(map[string]interface{}{
+		"path":  path,
+		"value": value,
+	})
 	if attempt != nil {
 		body["attempt"] = attempt
 	}
+	if attempts != "" {
+		body["attempts"] = attempts
+	}
 	b, err := json.Marshal(body)
 	if err != nil {
 		panic(err)
@@ -80,14 +114,13 @@ func (p *PactProxy) addModifier(interaction, path string, value interface{}, att
 	}
 }
 
-func (p *PactProxy) addConstraintFrom(interaction, pactPath, fromInteraction, format string, values []string) {
-	b, err := json.Marshal(map[string]interface{}{
-		"interaction": interaction,
-		"path":        pactPath,
-		"source":      fromInteraction,
-		"format":      format,
-		"values":      values,
-	})
+func (p *PactProxy) addConstraintFrom(s InteractionSetup, pactPath, fromInteraction, format string, values []string) {
+	b, err := json.Marshal(s.overlay(map[string]interface{}{
+		"path":   pactPath,
+		"source": fromInteraction,
+		"format": format,
+		"values": values,
+	}))
 	if err != nil {
 		panic(err)
 	}
@@ -160,6 +193,264 @@ func (p *PactProxy) ReadInteractionDetails(alias string) (*Interaction, error) {
 	return interaction, nil
 }
 
+// Constraints lists the constraints of an interaction, or of all interactions when interaction is empty,
+// optionally filtered by path
+func (p *PactProxy) Constraints(interaction, path string) ([]Constraint, error) {
+	var constraints []Constraint
+	if err := p.getOverlays("/interactions/constraints", interaction, path, &constraints); err != nil {
+		return nil, err
+	}
+	return constraints, nil
+}
+
+// DeleteConstraints removes the constraints added to an interaction, or to all interactions when interaction
+// is empty, optionally filtered by path. Constraints generated from the pact are kept.
+func (p *PactProxy) DeleteConstraints(interaction, path string) error {
+	return p.deleteOverlays("/interactions/constraints", interaction, path)
+}
+
+// Modifiers lists the modifiers of an interaction, or of all interactions when interaction is empty,
+// optionally filtered by path
+func (p *PactProxy) Modifiers(interaction, path string) ([]Modifier, error) {
+	var modifiers []Modifier
+	if err := p.getOverlays("/interactions/modifiers", interaction, path, &modifiers); err != nil {
+		return nil, err
+	}
+	return modifiers, nil
+}
+
+// DeleteModifiers removes the modifiers of an interaction, or of all interactions when interaction is empty,
+// optionally filtered by path
+func (p *PactProxy) DeleteModifiers(interaction, path string) error {
+	return p.deleteOverlays("/interactions/modifiers", interaction, path)
+}
+
+func overlayQuery(interaction, path string) string {
+	q := url.Values{}
+	if interaction != "" {
+		q.Add("interaction", interaction)
+	}
+	if path != "" {
+		q.Add("path", path)
+	}
+	if len(q) == 0 {
+		return ""
+	}
+	return "?" + q.Encode()
+}
+
+func (p *PactProxy) getOverlays(endpoint, interaction, path string, result interface{}) error {
+	res, err := p.client.Get(strings.TrimSuffix(p.url, "/") + endpoint + overlayQuery(interaction, path))
+	if err != nil {
+		return errors.Wrap(err, "http get")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		if res.StatusCode == http.StatusNotFound {
+			return InteractionNotFoundError
+		}
+		return errors.New("unexpected status code" + strconv.Itoa(res.StatusCode))
+	}
+	return json.NewDecoder(res.Body).Decode(result)
+}
+
+func (p *PactProxy) deleteOverlays(endpoint, interaction, path string) error {
+	r, _ := http.NewRequest("DELETE", strings.TrimSuffix(p.url, "/")+endpoint+overlayQuery(interaction, path), nil)
+	res, err := p.client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		if res.StatusCode == http.StatusNotFound {
+			return InteractionNotFoundError
+		}
+		return errors.New("unexpected status code" + strconv.Itoa(res.StatusCode))
+	}
+	return nil
+}
+
+func (p *PactProxy) UnmatchedRequests() ([]UnmatchedRequest, error) {
+	res, err := p.client.Get(strings.TrimSuffix(p.url, "/") + "/interactions/unmatched")
+	if err != nil {
+		return nil, errors.Wrap(err, "http get")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New("unexpected status code" + strconv.Itoa(res.StatusCode))
+	}
+
+	var requests []UnmatchedRequest
+	err = json.NewDecoder(res.Body).Decode(&requests)
+	if err != nil {
+		return nil, err
+	}
+	return requests, nil
+}
+
+func (p *PactProxy) ClearUnmatchedRequests() error {
+	r, _ := http.NewRequest("DELETE", strings.TrimSuffix(p.url, "/")+"/interactions/unmatched", nil)
+	res, err := p.client.Do(r)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return errors.New("unexpected status code" + strconv.Itoa(res.StatusCode))
+	}
+	return nil
+}
+
+// AssertNoUnmatchedRequests fails the test immediately if the proxy rejected any request,
+// reporting the reason and the violated constraints of each one
+func (p *PactProxy) AssertNoUnmatchedRequests(t TestingT) {
+	t.Helper()
+	requests, err := p.UnmatchedRequests()
+	if err != nil {
+		t.Errorf("unable to read unmatched requests: %v", err)
+		t.FailNow()
+		return
+	}
+	if len(requests) == 0 {
+		return
+	}
+
+	for _, r := range requests {
+		t.Errorf("unmatched request %s %s: %s", r.Method, r.Path, r.Reason)
+		for _, i := range r.Violations {
+			for _, v := range i.Violations {
+				t.Errorf("\t'%s': %s", i.Description, v.Reason)
+			}
+		}
+	}
+	t.FailNow()
+}
+
+// VerifyResponses checks that the responses to every interaction satisfied its response constraints,
+// the error lists the violations of those that did not
+func (p *PactProxy) VerifyResponses() error {
+	res, err := p.client.Get(strings.TrimSuffix(p.url, "/") + "/interactions/responses/verification")
+	if err != nil {
+		return errors.Wrap(err, "http get")
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var mismatch struct {
+		ErrorMessage string                  `json:"error_message"`
+		Interactions []InteractionViolations `json:"interactions"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&mismatch); err != nil {
+		return errors.New("unexpected status code" + strconv.Itoa(res.StatusCode))
+	}
+	var reasons []string
+	for _, i := range mismatch.Interactions {
+		for _, v := range i.Violations {
+			reasons = append(reasons, fmt.Sprintf("'%s': %s", i.Description, v.Reason))
+		}
+	}
+	return fmt.Errorf("%s: %s", mismatch.ErrorMessage, strings.Join(reasons, "; "))
+}
+
+// AddScenario creates a scenario, or replaces the scenario with its name, in its State or "Started"
+func (p *PactProxy) AddScenario(scenario Scenario) error {
+	b, err := json.Marshal(scenario)
+	if err != nil {
+		return err
+	}
+	res, err := p.client.Post(strings.TrimSuffix(p.url, "/")+"/scenarios", "application/json", bytes.NewBuffer(b))
+	if err != nil {
+		return errors.Wrap(err, "http post")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return errors.New("unexpected status code" + strconv.Itoa(res.StatusCode))
+	}
+	return nil
+}
+
+// SetScenarioState moves a scenario to the state
+func (p *PactProxy) SetScenarioState(name, state string) error {
+	b, err := json.Marshal(map[string]string{"state": state})
+	if err != nil {
+		return err
+	}
+	u := fmt.Sprintf("%s/scenarios/%s/state", strings.TrimSuffix(p.url, "/"), url.PathEscape(name))
+	r, _ := http.NewRequest(http.MethodPut, u, bytes.NewBuffer(b))
+	r.Header.Set("Content-Type", "application/json")
+	res, err := p.client.Do(r)
+	if err != nil {
+		return errors.Wrap(err, "http put")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return errors.New("unexpected status code" + strconv.Itoa(res.StatusCode))
+	}
+	return nil
+}
+
+// Scenarios lists the scenarios with their current states
+func (p *PactProxy) Scenarios() ([]Scenario, error) {
+	res, err := p.client.Get(strings.TrimSuffix(p.url, "/") + "/scenarios")
+	if err != nil {
+		return nil, errors.Wrap(err, "http get")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New("unexpected status code" + strconv.Itoa(res.StatusCode))
+	}
+
+	var scenarios []Scenario
+	if err := json.NewDecoder(res.Body).Decode(&scenarios); err != nil {
+		return nil, err
+	}
+	return scenarios, nil
+}
+
+// DeleteScenarios deletes every scenario, which is also done when the interactions or the session are deleted
+func (p *PactProxy) DeleteScenarios() error {
+	r, _ := http.NewRequest(http.MethodDelete, strings.TrimSuffix(p.url, "/")+"/scenarios", nil)
+	res, err := p.client.Do(r)
+	if err != nil {
+		return errors.Wrap(err, "http delete")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return errors.New("unexpected status code" + strconv.Itoa(res.StatusCode))
+	}
+	return nil
+}
+
+// ReloadPactFiles registers the interactions of the pact files the proxy was started with again,
+// in place of the interactions registered since
+func (p *PactProxy) ReloadPactFiles() error {
+	res, err := p.client.Post(strings.TrimSuffix(p.url, "/")+"/pacts/reload", "application/json", nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return errors.New("unexpected status code" + strconv.Itoa(res.StatusCode))
+	}
+	return nil
+}
+
+// RecordedPact reads the pact recorded by a proxy with the record backend, with matching rules inferred from the
+// values that vary between the recordings of an interaction when inferMatchingRules is set
+func (p *PactProxy) RecordedPact(inferMatchingRules bool) ([]byte, error) {
+	res, err := p.client.Get(fmt.Sprintf("%s/pact?infer=%t", strings.TrimSuffix(p.url, "/"), inferMatchingRules))
+	if err != nil {
+		return nil, errors.Wrap(err, "http get")
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.New("unexpected status code" + strconv.Itoa(res.StatusCode))
+	}
+	return io.ReadAll(res.Body)
+}
+
 func (p *PactProxy) IsReady() error {
 	res, err := p.client.Get(strings.TrimSuffix(p.url, "/") + "/ready")
 	if err != nil {
@@ -171,16 +462,45 @@ func (p *PactProxy) IsReady() error {
 	return nil
 }
 
+// InScenarioState returns a setup whose constraints and modifiers only apply while the scenario is in the state
+func (s InteractionSetup) InScenarioState(scenario, state string) InteractionSetup {
+	s.scenario, s.state = scenario, state
+	return s
+}
+
+// overlay adds the interaction, and the scenario state when there is one, to the body of a constraint or modifier
+func (s InteractionSetup) overlay(body map[string]interface{}) map[string]interface{} {
+	body["interaction"] = s.interaction
+	if s.scenario != "" {
+		body["scenario"], body["state"] = s.scenario, s.state
+	}
+	return body
+}
+
 func (s InteractionSetup) AddConstraint(path, value string) InteractionSetup {
-	s.pactProxy.addConstraint(s.interaction, path, value)
+	s.pactProxy.addConstraint(s, path, value)
+	return s
+}
+
+// AddOperatorConstraint adds a constraint that compares the value at path using operator,
+// e.g. regex, not_equals, one_of, contains, starts_with, gt, gte, lt, lte or between.
+func (s InteractionSetup) AddOperatorConstraint(path, operator string, values ...interface{}) InteractionSetup {
+	s.pactProxy.addOperatorConstraint(s, path, operator, values)
 	return s
 }
 
 func (s InteractionSetup) AddModifier(path string, value interface{}, attempt *int) InteractionSetup {
-	s.pactProxy.addModifier(s.interaction, path, value, attempt)
+	s.pactProxy.addModifier(s, path, value, attempt, "")
+	return s
+}
+
+// AddModifierForAttempts adds a modifier that applies to a pattern of attempts, e.g. "1-3", "4+", "1,3",
+// "every 2" or "first 2". A modifier for a single attempt takes precedence over a pattern of attempts.
+func (s InteractionSetup) AddModifierForAttempts(path string, value interface{}, attempts string) InteractionSetup {
+	s.pactProxy.addModifier(s, path, value, nil, attempts)
 	return s
 }
 
 func (s InteractionSetup) AddConstraintFrom(path, fromInteraction, format string, values ...string) {
-	s.pactProxy.addConstraintFrom(s.interaction, path, fromInteraction, format, values)
+	s.pactProxy.addConstraintFrom(s, path, fromInteraction, format, values)
 }
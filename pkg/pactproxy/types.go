@@ -1,19 +1,104 @@
 package pactproxy
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"time"
+)
 
 type Interaction struct {
-	Alias          string                 `json:"alias"`
-	Description    string                 `json:"description"`
-	Definition     map[string]interface{} `json:"definition"`
-	Method         string                 `json:"method"`
-	RequestCount   int                    `json:"request_count"`
-	RequestHistory []RequestDocument      `json:"request_history,omitempty"`
+	Alias              string                 `json:"alias"`
+	Description        string                 `json:"description"`
+	Type               string                 `json:"type,omitempty"`
+	Pending            bool                   `json:"pending,omitempty"`
+	Comments           map[string]interface{} `json:"comments,omitempty"`
+	Definition         map[string]interface{} `json:"definition"`
+	Method             string                 `json:"method"`
+	RequestCount       int                    `json:"request_count"`
+	RequestHistory     []RequestDocument      `json:"request_history,omitempty"`
+	ResponseViolations []ResponseViolations   `json:"response_violations,omitempty"`
+}
+
+// ResponseViolations are the response constraints the response to an attempt of an interaction did not satisfy
+type ResponseViolations struct {
+	Attempt    int                   `json:"attempt"`
+	Violations []ConstraintViolation `json:"violations"`
 }
 
 type RequestDocument struct {
-	Headers map[string]string `json:"headers"`
-	Query   json.RawMessage   `json:"query"`
-	Body    json.RawMessage   `json:"body"`
-	Path    string            `json:"path"`
+	Headers      map[string]string   `json:"headers"`
+	HeaderValues map[string][]string `json:"header_values"`
+	Query        json.RawMessage     `json:"query"`
+	QueryValues  json.RawMessage     `json:"query_values"`
+	Body         json.RawMessage     `json:"body"`
+	Path         string              `json:"path"`
+	Response     *ResponseDocument   `json:"response,omitempty"`
+}
+
+type ResponseDocument struct {
+	Status       int                 `json:"status"`
+	Headers      map[string]string   `json:"headers"`
+	HeaderValues map[string][]string `json:"header_values"`
+	Body         json.RawMessage     `json:"body"`
+}
+
+type UnmatchedRequest struct {
+	Method     string                  `json:"method"`
+	Path       string                  `json:"path"`
+	Query      string                  `json:"query,omitempty"`
+	Headers    map[string][]string     `json:"headers"`
+	Body       string                  `json:"body"`
+	Timestamp  time.Time               `json:"timestamp"`
+	Reason     string                  `json:"reason"`
+	Violations []InteractionViolations `json:"violations,omitempty"`
+}
+
+type InteractionViolations struct {
+	Description string                `json:"description"`
+	Alias       string                `json:"alias,omitempty"`
+	Violations  []ConstraintViolation `json:"violations"`
+}
+
+type ConstraintViolation struct {
+	Path     string      `json:"path"`
+	Expected interface{} `json:"expected,omitempty"`
+	Actual   interface{} `json:"actual,omitempty"`
+	Reason   string      `json:"reason"`
+}
+
+type Constraint struct {
+	Interaction string          `json:"interaction"`
+	Path        string          `json:"path"`
+	Values      []interface{}   `json:"values"`
+	Format      string          `json:"format"`
+	Source      string          `json:"source"`
+	Operator    string          `json:"operator,omitempty"`
+	Rule        json.RawMessage `json:"rule,omitempty"`
+	Scenario    string          `json:"scenario,omitempty"`
+	State       string          `json:"state,omitempty"`
+}
+
+type Modifier struct {
+	Interaction string      `json:"interaction"`
+	Path        string      `json:"path"`
+	Value       interface{} `json:"value"`
+	Attempt     *int        `json:"attempt"`
+	Attempts    string      `json:"attempts,omitempty"`
+	Scenario    string      `json:"scenario,omitempty"`
+	State       string      `json:"state,omitempty"`
+}
+
+// Scenario is a named state machine, modifiers and constraints can apply in one of its states only
+type Scenario struct {
+	Name        string               `json:"name"`
+	State       string               `json:"state,omitempty"`
+	Transitions []ScenarioTransition `json:"transitions,omitempty"`
+}
+
+// ScenarioTransition moves a scenario from a state, or any state when From is empty, to another once the
+// interaction has been matched After times in the state
+type ScenarioTransition struct {
+	Interaction string `json:"interaction"`
+	From        string `json:"from,omitempty"`
+	To          string `json:"to"`
+	After       int    `json:"after,omitempty"`
 }